@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// Decide how the author of retrigger commits is chosen
+//
+// Explicit names and emails win over the git config, which wins over the
+// Artemis account.
+func authorConfig() (artemis.AuthorConfig, error) {
+	author := artemis.AuthorConfig{
+		Name:  viper.GetString("author-name"),
+		Email: viper.GetString("author-email"),
+	}
+
+	if viper.GetBool("author-from-git-config") && (author.Name == "" || author.Email == "") {
+		name, email, err := gitConfigUser()
+		if err != nil {
+			return author, err
+		}
+		if author.Name == "" {
+			author.Name = name
+		}
+		if author.Email == "" {
+			author.Email = email
+		}
+	}
+
+	return author, nil
+}
+
+// Read user.name and user.email from the global or system git config
+func gitConfigUser() (string, string, error) {
+	var name, email string
+	for _, scope := range []gitconfig.Scope{gitconfig.GlobalScope, gitconfig.SystemScope} {
+		cfg, err := gitconfig.LoadConfig(scope)
+		if err != nil {
+			return "", "", fmt.Errorf("could not read the git config: %w", err)
+		}
+
+		if name == "" {
+			name = cfg.User.Name
+		}
+		if email == "" {
+			email = cfg.User.Email
+		}
+	}
+
+	return name, email, nil
+}
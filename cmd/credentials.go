@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/git"
+	"github.com/coronon/artemisbot/internal/util"
+	"github.com/coronon/artemisbot/internal/vault"
+)
+
+// Get the Artemis username and password
+//
+// Sources are tried in this order, the first one providing a password wins:
+//
+//  1. the interactive prompt (--interactive)
+//  2. the first line of stdin (--password-stdin)
+//  3. the output of --password-command
+//  4. the password config key or ARTEMISBOT_PASSWORD
+//  5. the credential vault entry of the Artemis host
+//  6. the netrc entry of the Artemis host
+//
+// The vault is only opened when no earlier source provides a password and
+// no token is configured, so it does not ask for its passphrase otherwise.
+// The username comes from the prompt, the config, the vault or the netrc
+// entry.
+func readCredentials(ctx context.Context, host string) (string, string, error) {
+	if viper.GetBool("interactive") {
+		log.Info("Please enter your Artemis credentials")
+		username, password, err := util.GetCredentialsInteractive()
+		if err != nil {
+			return "", "", fmt.Errorf("could not read credentials: %w", err)
+		}
+
+		log.Debug("Using the password from the interactive prompt")
+		return username, password, nil
+	}
+
+	netrcPath, netrc, err := lookupNetrc(host)
+	if err != nil {
+		return "", "", err
+	}
+
+	if viper.GetBool("password-stdin") {
+		password, err := util.ReadPasswordStdin()
+		if err != nil {
+			return "", "", err
+		}
+
+		log.Debug("Using the password from stdin")
+		return readUsername(host, netrc), password, nil
+	}
+
+	if command := viper.GetString("password-command"); command != "" {
+		password, err := util.RunPasswordCommand(ctx, command)
+		if err != nil {
+			return "", "", err
+		}
+
+		log.Debug("Using the password from the password command")
+		return readUsername(host, netrc), password, nil
+	}
+
+	if password := viper.GetString("password"); password != "" {
+		log.Debug("Using the password from the config")
+		return readUsername(host, netrc), password, nil
+	}
+
+	// A token replaces the password, so the vault is not needed
+	var stored *vault.Entry
+	if !tokenConfigured() {
+		if stored, err = vaultEntry(host); err != nil {
+			return "", "", err
+		}
+	}
+
+	username := viper.GetString("username")
+	if username == "" && stored != nil {
+		username = stored.Username
+	}
+	if username == "" && netrc != nil {
+		username = netrc.Login
+	}
+
+	// Entries for another account are of no use
+	if stored != nil && stored.Password != "" && (stored.Username == "" || stored.Username == username) {
+		log.Debug("Using the password from the credential vault")
+		return username, stored.Password, nil
+	}
+
+	if netrc != nil && netrc.Password != "" && (netrc.Login == "" || netrc.Login == username) {
+		log.Debugf("Using the password from %s", netrcPath)
+		return username, netrc.Password, nil
+	}
+
+	return username, "", nil
+}
+
+// Get the Artemis username without asking for or running anything secret
+//
+// The username comes from the config, the vault if it is already open or
+// the netrc entry.
+func readUsername(host string, netrc *util.NetrcEntry) string {
+	if username := viper.GetString("username"); username != "" {
+		return username
+	}
+	if stored := openedVaultEntry(host); stored != nil && stored.Username != "" {
+		return stored.Username
+	}
+	if netrc != nil {
+		return netrc.Login
+	}
+
+	return ""
+}
+
+// Whether a password source ranking above the credential vault is set
+func passwordConfigured() bool {
+	return viper.GetBool("interactive") ||
+		viper.GetBool("password-stdin") ||
+		viper.GetString("password-command") != "" ||
+		viper.GetString("password") != ""
+}
+
+// Find the netrc entry of the Artemis host, nil if there is none
+func lookupNetrc(host string) (string, *util.NetrcEntry, error) {
+	if host == "" {
+		return "", nil, nil
+	}
+
+	path, err := util.NetrcPath()
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry, err := util.LookupNetrc(path, host)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	return path, entry, nil
+}
+
+// Get the user-supplied Artemis JWT, empty if none was configured
+//
+// --token wins over --token-file, which wins over the credential vault. The
+// vault is skipped if a password is configured, as the password works just
+// as well and needs no passphrase.
+func readToken(host string) (string, error) {
+	if tokenConfigured() {
+		return readConfiguredToken()
+	}
+
+	stored := openedVaultEntry(host)
+	if stored == nil && !passwordConfigured() {
+		var err error
+		if stored, err = vaultEntry(host); err != nil {
+			return "", err
+		}
+	}
+	if stored == nil {
+		return "", nil
+	}
+	if stored.Token != "" {
+		log.Debug("Using the Artemis token from the credential vault")
+	}
+
+	return stored.Token, nil
+}
+
+// Get the JWT from --token or --token-file, empty if neither is set
+func readConfiguredToken() (string, error) {
+	if token := viper.GetString("token"); token != "" {
+		return strings.TrimSpace(token), nil
+	}
+
+	path := viper.GetString("token-file")
+	if path == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read the token file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Whether a token is given with --token or --token-file
+func tokenConfigured() bool {
+	return viper.GetString("token") != "" || viper.GetString("token-file") != ""
+}
+
+// Build the credentials for pushing to the participation repository
+//
+// With --git-transport ssh only the SSH settings are used. Otherwise a VCS
+// access token from --vcs-token or the credential vault is used instead of
+// the password. The vault is only opened for this if there is no password,
+// or if it is open already. With --fetch-vcs-token a missing token is
+// fetched from Artemis later on, so no password is needed for git.
+func gitCredentials(host, username, password string) (*git.GitCredentials, error) {
+	credentials := &git.GitCredentials{
+		Username: username,
+		Password: password,
+	}
+
+	var err error
+	switch transport := viper.GetString("git-transport"); transport {
+	case "https", "":
+	case "ssh":
+		credentials.SSH, err = sshConfig()
+		return credentials, err
+	default:
+		return nil, fmt.Errorf("unknown git transport: %s", transport)
+	}
+	if vcsToken := viper.GetString("vcs-token"); vcsToken != "" {
+		credentials.Token = vcsToken
+	} else {
+		stored := openedVaultEntry(host)
+		if stored == nil && password == "" {
+			if stored, err = vaultEntry(host); err != nil {
+				return nil, err
+			}
+		}
+		if stored != nil && stored.VCSToken != "" {
+			log.Debug("Using the VCS token from the credential vault")
+			credentials.Token = stored.VCSToken
+		}
+	}
+
+	if credentials.Secret() == "" && !viper.GetBool("fetch-vcs-token") {
+		return nil, fmt.Errorf("a VCS token (--vcs-token or --fetch-vcs-token) or password is required to push to the repository")
+	}
+
+	return credentials, nil
+}
+
+// Build the SSH settings from the flags
+func sshConfig() (*git.SSHConfig, error) {
+	config := &git.SSHConfig{
+		URLTemplate: viper.GetString("ssh-url-template"),
+		Port:        viper.GetInt("ssh-port"),
+		KeyFile:     viper.GetString("ssh-key"),
+		KnownHosts:  viper.GetStringSlice("known-hosts"),
+	}
+
+	if command := viper.GetString("ssh-key-passphrase-command"); command != "" {
+		passphrase, err := util.RunPasswordCommand(rootCmd.Context(), command)
+		if err != nil {
+			return nil, err
+		}
+		config.KeyPassphrase = passphrase
+	}
+
+	if config.KeyFile != "" {
+		log.Debugf("Using the SSH key %s", config.KeyFile)
+	} else {
+		log.Debug("Using the ssh-agent")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// feedbackCmd represents the feedback command
+var feedbackCmd = &cobra.Command{
+	Use:   "feedback",
+	Short: "Show the detailed feedback of a result",
+	Long: `Show which tests of an exercise passed, their credits and messages and the
+issues found by static code analysis. The most recent result is shown unless
+--result is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exerciseURL := viper.GetString("artemis-url")
+		matches := artemisURLRegex.FindStringSubmatch(exerciseURL)
+		if len(matches) != 4 {
+			log.Error("Failed to extract courseID and exerciseID from the URL")
+			return
+		}
+
+		client, err := newAPIClient(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		details, err := client.GetExerciseDetails(cmd.Context(), matches[3])
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(details.StudentParticipations) == 0 {
+			log.Error("You have not started this exercise yet")
+			return
+		}
+
+		resultID := viper.GetInt("result")
+		if resultID == 0 {
+			resultID = details.GetMostRecentResultID()
+		}
+		if resultID == 0 {
+			log.Info("There are no results for this exercise yet")
+			return
+		}
+
+		// The score is only known for results of the participation
+		participation := details.StudentParticipations[0]
+		found := false
+		var score float64
+		for _, result := range participation.Results {
+			if result.ID == resultID {
+				found = true
+				score = result.Score
+			}
+		}
+		if !found {
+			log.Errorf("Result %d does not belong to your participation in this exercise", resultID)
+			return
+		}
+
+		feedback, err := client.GetResultFeedback(cmd.Context(), participation.ID, resultID)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		feedback.Score = score
+
+		if viper.GetBool("json") {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(feedback); err != nil {
+				log.Error(err.Error())
+			}
+			return
+		}
+		printFeedback(feedback)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(feedbackCmd)
+
+	feedbackCmd.Flags().StringP("artemis-url", "t", "", "URL of the Artemis exercise")
+	feedbackCmd.Flags().Int("result", 0, "ID of the result to show (default is the most recent one)")
+	feedbackCmd.Flags().Bool("json", false, "print the feedback as JSON")
+}
+
+// Print the feedback of a result as a readable report
+func printFeedback(feedback *artemis.ResultFeedback) {
+	fmt.Printf(
+		"Result %d: %.0f%% (%d/%d tests passed, %d code issues)\n",
+		feedback.ResultID,
+		feedback.Score,
+		feedback.PassedTests(),
+		len(feedback.Tests),
+		len(feedback.Issues),
+	)
+
+	if len(feedback.Tests) > 0 {
+		fmt.Println("\nTests:")
+		for _, test := range feedback.Tests {
+			mark := "✘"
+			if test.Passed {
+				mark = "✔"
+			}
+			fmt.Printf("  %s %s (%g)\n", mark, test.Name, test.Credits)
+			printIndented(test.Detail)
+		}
+	}
+
+	if len(feedback.Issues) > 0 {
+		fmt.Println("\nCode issues:")
+		for _, issue := range feedback.Issues {
+			location := issue.File
+			if issue.StartLine > 0 {
+				location = fmt.Sprintf("%s:%d", issue.File, issue.StartLine)
+			}
+			if issue.Rule != "" {
+				fmt.Printf("  %s [%s/%s] %s\n", location, issue.Category, issue.Rule, issue.Message)
+			} else {
+				fmt.Printf("  %s [%s] %s\n", location, issue.Category, issue.Message)
+			}
+		}
+	}
+
+	if len(feedback.Comments) > 0 {
+		fmt.Println("\nComments:")
+		for _, comment := range feedback.Comments {
+			fmt.Printf("  %s (%g)\n", comment.Text, comment.Credits)
+			printIndented(comment.Detail)
+		}
+	}
+}
+
+// Print a multi-line message below a report entry
+func printIndented(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Printf("      %s\n", line)
+	}
+}
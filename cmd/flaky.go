@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+	"github.com/coronon/artemisbot/internal/flaky"
+)
+
+// flakyCmd represents the flaky command
+var flakyCmd = &cobra.Command{
+	Use:   "flaky",
+	Short: "Report flaky tests from previous retrigger attempts",
+	Long: `Show the pass rate of every test across the attempts retrigger recorded for
+an exercise, which tests never passed and how many more attempts it likely
+takes to reach the desired percentage. This works while retrigger is running.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exerciseURL := viper.GetString("artemis-url")
+		matches := artemisURLRegex.FindStringSubmatch(exerciseURL)
+		if len(matches) != 4 {
+			log.Error("Failed to extract courseID and exerciseID from the URL")
+			return
+		}
+
+		instanceConfig, err := artemisConfig(matches[1])
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		username, err := historyUsername(instanceConfig.Host())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		history := flaky.NewHistory(viper.GetString("workdir"))
+		key := flaky.Key(instanceConfig.ArtemisHttpURL, username, matches[3])
+
+		if viper.GetBool("reset") {
+			removed, err := history.Delete(key)
+			if err != nil {
+				log.Error(err.Error())
+				return
+			}
+			if !removed {
+				log.Info("There are no recorded attempts")
+				return
+			}
+			log.Info("Removed the recorded attempts")
+			return
+		}
+
+		attempts, err := history.Load(key)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		report := flaky.Analyze(attempts, viper.GetInt("percentage"))
+
+		if viper.GetBool("json") {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(report); err != nil {
+				log.Error(err.Error())
+			}
+			return
+		}
+		if report.Attempts == 0 {
+			log.Info("There are no recorded attempts for this exercise yet")
+			return
+		}
+		printFlakyReport(report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flakyCmd)
+
+	flakyCmd.Flags().StringP("artemis-url", "t", "", "URL of the Artemis exercise")
+	flakyCmd.Flags().IntP("percentage", "p", 100, "Percentage of points to reach")
+	flakyCmd.Flags().Bool("json", false, "print the report as JSON")
+	flakyCmd.Flags().Bool("reset", false, "forget the recorded attempts, e.g. after changing the code")
+}
+
+// The user whose attempts to look up, without logging in
+//
+// Only a username is needed, so it comes from the config, the subject of a
+// configured token or the netrc entry without reading any secret.
+func historyUsername(host string) (string, error) {
+	if username := viper.GetString("username"); username != "" {
+		return username, nil
+	}
+
+	token, err := readConfiguredToken()
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		return artemis.TokenUsername(token)
+	}
+
+	_, netrc, err := lookupNetrc(host)
+	if err != nil {
+		return "", err
+	}
+	if netrc != nil && netrc.Login != "" {
+		return netrc.Login, nil
+	}
+
+	return "", fmt.Errorf("username is required")
+}
+
+// Print the pass rates of the tests and the attempts still needed
+func printFlakyReport(report *flaky.Report) {
+	fmt.Printf("%d attempts recorded\n", report.Attempts)
+
+	if len(report.Tests) > 0 {
+		fmt.Println("\nTests:")
+		for _, test := range report.Tests {
+			label := ""
+			switch {
+			case test.AlwaysFails():
+				label = " always fails"
+			case test.Flaky():
+				label = " flaky"
+			}
+			fmt.Printf("  %5.1f%% %s (%d/%d)%s\n", test.PassRate*100, test.Name, test.Passes, test.Runs, label)
+		}
+	}
+
+	if len(report.DeterministicFailures) > 0 {
+		fmt.Printf("\nNever passed, retrying will not fix: %s\n", strings.Join(report.DeterministicFailures, ", "))
+	}
+
+	fmt.Println()
+	switch {
+	case !report.Reachable:
+		fmt.Printf("%d%% is out of reach with the recorded pass rates, fix the failing tests first\n", report.DesiredPercentage)
+	case report.SuccessProbability >= 1:
+		fmt.Printf("Every recorded attempt would reach %d%%\n", report.DesiredPercentage)
+	default:
+		fmt.Printf(
+			"An attempt reaches %d%% with a chance of %.1f%%, expect %.1f more attempts (%d for 90%% certainty)\n",
+			report.DesiredPercentage,
+			report.SuccessProbability*100,
+			report.ExpectedAttempts,
+			report.ConfidentAttempts,
+		)
+	}
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"slices"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+	"github.com/coronon/artemisbot/internal/git"
+	"github.com/coronon/artemisbot/internal/util"
+	"github.com/coronon/artemisbot/internal/vault"
+)
+
+// gitCredentialCmd represents the git-credential command
+var gitCredentialCmd = &cobra.Command{
+	Use:   "git-credential <get|store|erase>",
+	Short: "git credential helper for Artemis repositories",
+	Long: `Speak git's credential helper protocol so that plain git uses the same
+credentials as artemisbot. Register it with:
+
+  git config --global credential.https://artemis.example.com.helper "artemisbot git-credential"
+
+Only requests for the Artemis instance and the hosts given with --vcs-host are
+answered, git asks the next helper for all others. "store" keeps VCS tokens
+that git used successfully in the credential vault (if there is one), "erase"
+removes a rejected VCS token from it. The vault passphrase is asked for on the
+terminal unless --vault-passphrase-command is set.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"get", "store", "erase"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Stdin and stdout belong to the helper protocol, so never read secrets
+		// from them and ask for the vault passphrase on the terminal instead
+		viper.Set("interactive", false)
+		viper.Set("password-stdin", false)
+		promptVaultPassphrase = util.PromptSecretTerminal
+
+		desc, err := git.ReadCredentialDescription(os.Stdin)
+		if err != nil {
+			log.Errorf("Could not read the credential request: %s", err.Error())
+			os.Exit(1)
+		}
+
+		host, ok := credentialHelperHost(desc)
+		if !ok {
+			log.Debugf("Ignoring the credential request for %s", desc.Host)
+			return
+		}
+
+		switch args[0] {
+		case "get":
+			err = gitCredentialGet(cmd, desc, host)
+		case "store":
+			err = gitCredentialStore(desc, host)
+		case "erase":
+			err = gitCredentialErase(desc, host)
+		default:
+			// Unknown operations must be ignored according to git-credential(1)
+			return
+		}
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitCredentialCmd)
+
+	gitCredentialCmd.Flags().StringSlice("vcs-host", []string{}, "additional hosts serving Artemis repositories")
+}
+
+// Decide whether a request is for Artemis and which host holds its credentials
+//
+// Credentials stored in the vault for the VCS host itself win over those of
+// the Artemis instance.
+func credentialHelperHost(desc *git.CredentialDescription) (string, bool) {
+	if desc.Protocol != "https" && desc.Protocol != "http" {
+		return "", false
+	}
+
+	vcsHost := desc.Host
+	if hostname, _, err := net.SplitHostPort(desc.Host); err == nil {
+		vcsHost = hostname
+	}
+
+	instanceConfig, err := artemisConfig(exerciseInstance(viper.GetString("artemis-url")))
+	if err != nil {
+		log.Error(err.Error())
+		return "", false
+	}
+	instanceHost := instanceConfig.Host()
+
+	if vcsHost != instanceHost && !slices.Contains(viper.GetStringSlice("vcs-host"), vcsHost) {
+		return "", false
+	}
+
+	// Only look into the vault for accepted hosts, opening it may prompt
+	if vcsHost != instanceHost {
+		if entry, err := vaultEntry(vcsHost); err == nil && entry != nil {
+			return vcsHost, true
+		}
+	}
+
+	return instanceHost, true
+}
+
+// Reply with the credentials artemisbot would use to push
+func gitCredentialGet(cmd *cobra.Command, desc *git.CredentialDescription, host string) error {
+	username, password, err := readCredentials(cmd.Context(), host)
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		token, err := readToken(host)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			if username, err = artemis.TokenUsername(token); err != nil {
+				return err
+			}
+		}
+	}
+	if username == "" {
+		log.Debug("No username configured, leaving the request to other helpers")
+		return nil
+	}
+
+	// git asked for another account
+	if desc.Username != "" && desc.Username != username {
+		return nil
+	}
+
+	credentials, err := gitCredentials(host, username, password)
+	if err != nil {
+		log.Debugf("No credentials available: %s", err.Error())
+		return nil
+	}
+
+	reply := &git.CredentialDescription{
+		Username: credentials.Username,
+		Password: credentials.Secret(),
+	}
+	return reply.Write(os.Stdout)
+}
+
+// Keep a working VCS token in the vault
+//
+// Account passwords are confirmed the same way, so only secrets that look
+// like Artemis VCS tokens are stored.
+func gitCredentialStore(desc *git.CredentialDescription, host string) error {
+	if desc.Username == "" || !artemis.IsVCSAccessToken(desc.Password) || !vault.Exists(viper.GetString("workdir")) {
+		return nil
+	}
+
+	v, err := openVault(false)
+	if err != nil {
+		return err
+	}
+
+	entry, _ := v.Get(host)
+	if entry.Username != "" && entry.Username != desc.Username {
+		return nil
+	}
+	if entry.Password == desc.Password || entry.VCSToken == desc.Password {
+		return nil
+	}
+
+	entry.Username = desc.Username
+	entry.VCSToken = desc.Password
+	v.Set(host, entry)
+
+	return v.Save()
+}
+
+// Remove a VCS token that the server rejected from the vault
+func gitCredentialErase(desc *git.CredentialDescription, host string) error {
+	if !vault.Exists(viper.GetString("workdir")) {
+		return nil
+	}
+
+	v, err := openVault(false)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := v.Get(host)
+	if !ok || entry.VCSToken == "" || (desc.Password != "" && desc.Password != entry.VCSToken) {
+		return nil
+	}
+
+	entry.VCSToken = ""
+	v.Set(host, entry)
+
+	return v.Save()
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/config"
+)
+
+// Build the Artemis config from the flags, config file and environment
+//
+// An explicit --instance wins over the instance derived from a link to an
+// exercise (fallbackInstance), which wins over the default instance.
+// --artemis-http-url and --artemis-ws-url override the derived base URLs.
+func artemisConfig(fallbackInstance string) (*config.Config, error) {
+	instance := viper.GetString("instance")
+	if instance == "" {
+		instance = fallbackInstance
+	}
+	if instance == "" {
+		instance = config.DefaultInstanceURL
+	}
+
+	cfg, err := config.NewConfig(instance)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Override(viper.GetString("artemis-http-url"), viper.GetString("artemis-ws-url"))
+
+	return cfg, nil
+}
+
+// The instance part of a link to an exercise, empty if it is not one
+func exerciseInstance(exerciseURL string) string {
+	matches := artemisURLRegex.FindStringSubmatch(exerciseURL)
+	if len(matches) != 4 {
+		return ""
+	}
+
+	return matches[1]
+}
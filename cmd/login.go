@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// loginCmd represents the login command
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to Artemis and cache the session",
+	Long: `Log in to Artemis with your password and store the session in the workdir.
+Later runs reuse the session until it expires instead of logging in again.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		instanceConfig, err := artemisConfig(exerciseInstance(viper.GetString("artemis-url")))
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		username, password, err := readCredentials(cmd.Context(), instanceConfig.Host())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if username == "" || password == "" {
+			log.Error("Username and password are required")
+			return
+		}
+
+		client := artemis.NewArtemisHTTPClient(instanceConfig, username, password, viper.GetString("workdir"))
+		if err := client.Reauthenticate(cmd.Context()); err != nil {
+			log.Errorf("Could not log in: %s", err.Error())
+			return
+		}
+
+		log.Infof(
+			"Logged in as %s, the session is valid until %s 🔑",
+			username,
+			client.SessionExpiry().Local().Format(time.DateTime),
+		)
+	},
+}
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the cached Artemis session",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		username := viper.GetString("username")
+		if username == "" {
+			log.Error("Username is required")
+			return
+		}
+
+		instanceConfig, err := artemisConfig(exerciseInstance(viper.GetString("artemis-url")))
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		client := artemis.NewArtemisHTTPClient(instanceConfig, username, "", viper.GetString("workdir"))
+		removed, err := client.Logout()
+		if err != nil {
+			log.Errorf("Could not log out: %s", err.Error())
+			return
+		}
+		if !removed {
+			log.Infof("No session cached for %s", username)
+			return
+		}
+
+		log.Infof("Logged out %s", username)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+}
+
+// Create a logged in client for commands that only use the HTTP API
+//
+// A supplied token is used as is, otherwise a cached session is reused
+// before falling back to a password login.
+func newAPIClient(ctx context.Context) (*artemis.ArtemisClient, error) {
+	instanceConfig, err := artemisConfig(exerciseInstance(viper.GetString("artemis-url")))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := readToken(instanceConfig.Host())
+	if err != nil {
+		return nil, err
+	}
+	username, password, err := readCredentials(ctx, instanceConfig.Host())
+	if err != nil {
+		return nil, err
+	}
+
+	client := artemis.NewArtemisHTTPClient(instanceConfig, username, password, viper.GetString("workdir"))
+	if token != "" {
+		if err := client.UseToken(token); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if err := client.Login(ctx); err != nil {
+		return nil, fmt.Errorf("could not log in: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the build log of your latest submission",
+	Long: `Show the build log of the latest submission of an exercise, or of the
+submission of --result, and guess why the build failed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exerciseURL := viper.GetString("artemis-url")
+		matches := artemisURLRegex.FindStringSubmatch(exerciseURL)
+		if len(matches) != 4 {
+			log.Error("Failed to extract courseID and exerciseID from the URL")
+			return
+		}
+
+		client, err := newAPIClient(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		details, err := client.GetExerciseDetails(cmd.Context(), matches[3])
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(details.StudentParticipations) == 0 {
+			log.Error("You have not started this exercise yet")
+			return
+		}
+
+		entries, err := client.GetBuildLogs(cmd.Context(), details.StudentParticipations[0].ID, viper.GetInt("result"))
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(entries) == 0 {
+			log.Info("There is no build log, the last build probably succeeded")
+			return
+		}
+
+		// Classify the full log, the cause may be above the tail
+		failure := artemis.ClassifyBuildLog(entries)
+		if tail := viper.GetInt("tail"); tail > 0 {
+			entries = entries[max(len(entries)-tail, 0):]
+		}
+		printBuildLog(entries)
+
+		if failure != artemis.BuildFailureUnknown {
+			log.Infof("The build most likely failed because of a %s", failure)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringP("artemis-url", "t", "", "URL of the Artemis exercise")
+	logsCmd.Flags().Int("result", 0, "ID of the result to show the build log of (default is the latest submission)")
+	logsCmd.Flags().Int("tail", 0, "only show the last lines of the log")
+}
+
+// Print build log entries with their local time
+func printBuildLog(entries []*artemis.BuildLogEntry) {
+	for _, entry := range entries {
+		if entry.Time == nil {
+			fmt.Println(entry.Log)
+			continue
+		}
+		fmt.Printf("%s %s\n", entry.Time.Local().Format(time.TimeOnly), entry.Log)
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Config key holding all profiles, e.g. profiles.work.username
+const profilesKey = "profiles"
+
+// Value shown instead of secrets
+const redacted = "********"
+
+var profileName string
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Inspect configuration profiles",
+	Long: `Profiles bundle settings like the username, Artemis instance and workdir
+under a name in the config file. Select one with --profile or ARTEMISBOT_PROFILE.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		names := profileNames()
+		if len(names) == 0 {
+			log.Info("No profiles configured")
+			return
+		}
+
+		active := activeProfile()
+		for _, name := range names {
+			if name == active {
+				fmt.Printf("* %s\n", name)
+			} else {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	},
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the settings of a profile (default is the active one)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := activeProfile()
+		if len(args) == 1 {
+			name = strings.ToLower(args[0])
+		}
+		if name == "" {
+			log.Error("No profile is active, pass the name of the profile to show")
+			return
+		}
+
+		settings, err := profileSettings(name)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Printf("Profile %s:\n", name)
+		for _, key := range keys {
+			value := fmt.Sprintf("%v", settings[key])
+			if isSecretKey(key) {
+				value = redacted
+			}
+			fmt.Printf("  %s: %s\n", key, value)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileShowCmd)
+
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "name of the config profile to use")
+}
+
+// The name of the selected profile, empty if none is selected
+//
+// The --profile flag wins over ARTEMISBOT_PROFILE, which wins over the
+// top-level "profile" key of the config file.
+func activeProfile() string {
+	// Viper lowercases all keys, including the profile names
+	if profileName != "" {
+		return strings.ToLower(profileName)
+	}
+
+	return strings.ToLower(viper.GetString("profile"))
+}
+
+// Names of all profiles in the config file
+func profileNames() []string {
+	names := []string{}
+	for name := range viper.GetStringMap(profilesKey) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// The flattened settings of a profile
+func profileSettings(name string) (map[string]interface{}, error) {
+	profile := viper.Sub(profilesKey + "." + name)
+	if profile == nil {
+		return nil, fmt.Errorf("profile %q does not exist", name)
+	}
+
+	settings := map[string]interface{}{}
+	for _, key := range profile.AllKeys() {
+		settings[key] = profile.Get(key)
+	}
+
+	return settings, nil
+}
+
+// Layer the settings of the active profile over the rest of the config file
+//
+// Flags and environment variables still take precedence over the profile.
+func applyProfile() error {
+	name := activeProfile()
+	if name == "" {
+		return nil
+	}
+
+	profile := viper.Sub(profilesKey + "." + name)
+	if profile == nil {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	return viper.MergeConfigMap(profile.AllSettings())
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "password") || strings.Contains(key, "token") || strings.Contains(key, "secret")
+}
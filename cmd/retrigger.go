@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -9,14 +12,12 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/coronon/artemisbot/internal/artemis"
+	"github.com/coronon/artemisbot/internal/flaky"
 	"github.com/coronon/artemisbot/internal/git"
-	"github.com/coronon/artemisbot/internal/sockjs"
-	"github.com/coronon/artemisbot/internal/util"
+	"github.com/coronon/artemisbot/internal/retrigger"
 )
 
-var artemisURLRegex = regexp.MustCompile(`^https?://.+/courses/(?P<course>\d*)/exercises/(?P<task>\d*)/?`)
-var expectingResult = true
-var isExiting = false
+var artemisURLRegex = regexp.MustCompile(`^(?P<instance>https?://.+?)/courses/(?P<course>\d*)/exercises/(?P<task>\d*)/?`)
 
 // retriggerCmd represents the retrigger command
 var retriggerCmd = &cobra.Command{
@@ -24,50 +25,45 @@ var retriggerCmd = &cobra.Command{
 	Short: "Retrigger artemis build tasks",
 	Long:  `Trigger the artemis build task until the desired percentage is reached.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
-
 		log.Info("Starting ArtemisBot 🤖")
 
 		// Get options
-		username := viper.GetString("username")
-		password := viper.GetString("password")
 		desiredPercentage := viper.GetInt("percentage")
-		artemisURL := viper.GetString("artemis-url")
-		isInteractive := viper.GetBool("interactive")
+		artemisURLs := viper.GetStringSlice("artemis-url")
 		workDir := viper.GetString("workdir")
-		verbose := viper.GetBool("verbose")
+		gitBackend := viper.GetString("git-backend")
 
-		// Set log level
-		if verbose {
-			log.SetLevel(log.DebugLevel)
+		// Extract courseID and exerciseID from the URLs
+		if len(artemisURLs) == 0 {
+			log.Error("Artemis URL is required")
+			return
 		}
 
-		// Ensure that the username and password are set
-		if isInteractive {
-			log.Info("Please enter your Artemis credentials")
-			username, password, err = util.GetCredentialsInteractive()
-			if err != nil {
-				log.Errorf("Could not read credentials: %s", err.Error())
+		exercises := make([]exercise, 0, len(artemisURLs))
+		for _, artemisURL := range artemisURLs {
+			matches := artemisURLRegex.FindStringSubmatch(artemisURL)
+			if len(matches) != 4 {
+				log.Errorf("Failed to extract courseID and exerciseID from the URL %s", artemisURL)
+				return
+			}
+			if len(exercises) > 0 && matches[1] != exercises[0].instance {
+				log.Error("All exercises must be on the same Artemis instance")
 				return
 			}
-		} else if username == "" || password == "" {
-			log.Error("Username and password are required")
-			return
-		}
 
-		// Extract courseID and exerciseID from the URL
-		if artemisURL == "" {
-			log.Error("Artemis URL is required")
-			return
+			exercises = append(exercises, exercise{
+				instance: matches[1],
+				courseID: matches[2],
+				taskID:   matches[3],
+			})
 		}
 
-		matches := artemisURLRegex.FindStringSubmatch(artemisURL)
-		if len(matches) != 3 {
-			log.Error("Failed to extract courseID and exerciseID from the URL")
+		instanceConfig, err := artemisConfig(exercises[0].instance)
+		if err != nil {
+			log.Error(err.Error())
 			return
 		}
-		courseID := matches[1]
-		taskID := matches[2]
+		log.Debugf("Using the Artemis instance at %s", instanceConfig.ArtemisHttpURL)
 
 		// Check if the desired percentage is valid
 		if desiredPercentage < 0 {
@@ -79,151 +75,218 @@ var retriggerCmd = &cobra.Command{
 			return
 		}
 
-		// Start the loop
-		shouldRunAgain := true
-		for shouldRunAgain {
-			shouldRunAgain = loop(username, password, workDir, courseID, taskID, desiredPercentage)
+		// Ensure that the username and password (or a token) are set
+		token, err := readToken(instanceConfig.Host())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		username, password, err := readCredentials(cmd.Context(), instanceConfig.Host())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if token != "" && username == "" {
+			if username, err = artemis.TokenUsername(token); err != nil {
+				log.Error(err.Error())
+				return
+			}
+		}
+		if username == "" {
+			log.Error("Username is required")
+			return
+		}
+		if password == "" && token == "" {
+			log.Debug("No password or token configured, relying on a cached session")
+		}
+		gitCredentials, err := gitCredentials(instanceConfig.Host(), username, password)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		author, err := authorConfig()
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		// All exercises share one client and websocket
+		session := retrigger.NewSession(retrigger.SessionConfig{
+			Artemis:  instanceConfig,
+			Username: username,
+			Password: password,
+			Token:    token,
+			WorkDir:  workDir,
+		}, logRetriggerEvent(log.Default()))
+		defer session.Close()
+
+		// Test outcomes of every attempt are kept for the flaky test report
+		history := flaky.NewHistory(workDir)
+
+		// Only the loops shut down gracefully, prompts before them are left to
+		// the default signal handling so the terminal state is restored
+		ctx, stop := withShutdownSignals(cmd.Context())
+		defer stop()
 
-			if shouldRunAgain {
-				log.Warn("Something went wrong, retrying in 5 seconds...")
-				time.Sleep(5 * time.Second)
+		// Start the loops
+		runners := make([]*retrigger.Runner, len(exercises))
+		loggers := make([]*log.Logger, len(exercises))
+		historyKeys := make([]string, len(exercises))
+		var wg sync.WaitGroup
+		for i, exercise := range exercises {
+			loggers[i] = log.Default()
+			if len(exercises) > 1 {
+				loggers[i] = log.With("exercise", exercise.taskID)
 			}
+
+			historyKeys[i] = flaky.Key(instanceConfig.ArtemisHttpURL, username, exercise.taskID)
+			runners[i] = retrigger.NewRunner(retrigger.Config{
+				Session:           session,
+				GitCredentials:    gitCredentials,
+				FetchVCSToken:     viper.GetBool("fetch-vcs-token"),
+				Author:            author,
+				WorkDir:           workDir,
+				CourseID:          exercise.courseID,
+				TaskID:            exercise.taskID,
+				DesiredPercentage: desiredPercentage,
+				GitBackend:        gitBackend,
+				BuildLogLines:     viper.GetInt("build-log-lines"),
+				History:           history,
+				HistoryKey:        historyKeys[i],
+			}, logRetriggerEvent(loggers[i]))
+
+			wg.Add(1)
+			go func(runner *retrigger.Runner, logger *log.Logger) {
+				defer wg.Done()
+				defer runner.Close()
+
+				err := runner.Run(ctx)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					logger.Error(err.Error())
+				}
+			}(runners[i], loggers[i])
 		}
+		wg.Wait()
 
+		for i, runner := range runners {
+			logSummary(loggers[i], runner)
+			logFlakyReport(loggers[i], history, historyKeys[i], desiredPercentage)
+		}
 	},
 }
 
+// An exercise to retrigger, parsed from its URL
+type exercise struct {
+	instance string
+	courseID string
+	taskID   string
+}
+
 func init() {
 	rootCmd.AddCommand(retriggerCmd)
 
-	retriggerCmd.PersistentFlags().StringP("artemis-url", "t", "https://artemis.in.tum.de/courses/?/exercises/?", "URL of the Artemis task to automate")
+	retriggerCmd.PersistentFlags().StringSliceP("artemis-url", "t", []string{"https://artemis.in.tum.de/courses/?/exercises/?"}, "URL of the Artemis task to automate, repeat to retrigger several at once")
 	retriggerCmd.PersistentFlags().IntP("percentage", "p", 100, "Percentage of points to reach")
+	retriggerCmd.PersistentFlags().Bool("fetch-vcs-token", false, "get a VCS access token for the participation from Artemis and use it for git")
+	retriggerCmd.PersistentFlags().String("git-transport", "https", "how to access the repository (https or ssh)")
+	retriggerCmd.PersistentFlags().Int("ssh-port", git.DefaultSSHPort, "SSH port of the Artemis instance")
+	retriggerCmd.PersistentFlags().String("ssh-url-template", git.DefaultSSHURLTemplate, "template of the SSH repository URI ({host}, {port}, {path}, {user})")
+	retriggerCmd.PersistentFlags().String("ssh-key", "", "private SSH key (default is to use the ssh-agent)")
+	retriggerCmd.PersistentFlags().String("ssh-key-passphrase-command", "", "shell command that prints the passphrase of the SSH key")
+	retriggerCmd.PersistentFlags().StringSlice("known-hosts", []string{}, "known_hosts files to verify the host key against (default is ~/.ssh/known_hosts)")
+	retriggerCmd.PersistentFlags().String("git-backend", git.BackendNative, "git implementation used to push (native or go-git)")
+	retriggerCmd.PersistentFlags().Int("build-log-lines", 20, "lines of the build log to show when a build fails")
+	retriggerCmd.PersistentFlags().String("author-name", "", "commit author name, may use {login}, {name}, {firstName}, {lastName} and {email} (default is the name of the Artemis account)")
+	retriggerCmd.PersistentFlags().String("author-email", "", "commit author email, may use the same placeholders (default is the email of the Artemis account)")
+	retriggerCmd.PersistentFlags().Bool("author-from-git-config", false, "use user.name and user.email from the git config")
 }
 
-func loop(username, password, workDir, courseID, taskID string, desiredPercentage int) bool {
-	log.Debug("Bootsrapping Artemis client...")
-	// Create an Artemis client
-	client, err := artemis.NewArtemisClient(username, password, workDir)
-	if err != nil {
-		log.Errorf("Could not create an Artemis client: %s", err.Error())
-		return false
-	}
-	log.Debug("Artemis client bootstrapped")
-
-	log.Debug("Creating a new Artemis task...")
-	// Create a new Artemis task
-	task, err := artemis.NewRetriggerTask(
-		client,
-		courseID,
-		taskID,
-		&git.GitCredentials{
-			Username: username,
-			Password: password,
-		},
-		desiredPercentage,
-	)
-	if err != nil {
-		log.Errorf("Could not create a new Artemis task: %s", err.Error())
-		return false
-	}
-	defer task.Cleanup()
-	log.Debug("Artemis task created")
-
-	// Ensure that the desired percentage is not already reached
-	if task.CurrentPercentage >= task.DesiredPercentage {
-		log.Info("The desired percentage is already reached 😎")
-		return false
-	}
-
-	// Start listening for build events
-	if err = client.WS.Subscribe("/user/topic/newSubmissions"); err != nil {
-		log.Errorf("Could not subscribe to new submissions: %s", err.Error())
-		return true
-	}
-	if err = client.WS.Subscribe("/user/topic/newResults"); err != nil {
-		log.Errorf("Could not subscribe to new results: %s", err.Error())
-		return true
-	}
-
-	log.Info("Starting the Artemis task... 🚀")
-	timer := time.NewTimer(1 * time.Millisecond)
-	timeout := time.NewTimer(10 * time.Minute)
-	for {
-		select {
-		case <-timeout.C:
-			log.Error("Timeout reached, exiting...")
-			return true
-		case <-timer.C:
-			// Retrigger the task
-			timeout.Stop()
-			err = retriggerTask(task)
-			if err != nil {
-				log.Errorf("Could not retrigger the task: %s", err.Error())
-				return true
+// Print the progress of a retrigger run to logger
+func logRetriggerEvent(logger *log.Logger) func(retrigger.Event) {
+	return func(event retrigger.Event) {
+		switch event.Type {
+		case retrigger.EventStateChanged:
+			logger.Debugf("Retrigger state: %s", event.State)
+			if event.State == retrigger.StatePushing {
+				logger.Info("Retriggering the task... ⚙️")
 			}
-			timeout.Reset(10 * time.Minute)
-		case msg := <-client.WS.Messages():
-			err, shouldRetrigger := handleWSMessage(client, task, msg)
-			if err != nil {
-				log.Errorf("Could not handle websocket message: %s", err.Error())
-				return true
+		case retrigger.EventStarted:
+			logger.Info("Starting the Artemis task... 🚀")
+		case retrigger.EventPushed:
+			logger.Infof("Retriggered the task with commit hash %s", event.CommitHash)
+		case retrigger.EventSubmission:
+			logger.Info("Artemis is building a new submission 📦")
+		case retrigger.EventUnexpectedSubmission:
+			logger.Warn("Artemis had a little hiccup and sent a new submission before the results 🤔")
+		case retrigger.EventResult:
+			logger.Infof("Received new results: %d%%", event.Percentage)
+		case retrigger.EventAlreadyReached:
+			logger.Info("The desired percentage is already reached 😎")
+		case retrigger.EventReached:
+			logger.Infof("The desired percentage is reached: %d%% 🎉", event.Percentage)
+		case retrigger.EventReconnected:
+			logger.Warnf(
+				"Reconnected to the Artemis websocket after %s, results may have been missed",
+				event.Downtime.Round(time.Second),
+			)
+		case retrigger.EventError:
+			logger.Error(event.Err.Error())
+		case retrigger.EventTimeout:
+			logger.Error("Timeout reached, starting over...")
+		case retrigger.EventRetrying:
+			logger.Warnf("Something went wrong, retrying in %s...", event.Delay)
+		case retrigger.EventIgnoredSubmission:
+			logger.Debugf("Ignoring a submission of participation %d for commit %s", event.ParticipationID, event.CommitHash)
+		case retrigger.EventIgnoredResult:
+			logger.Debugf("Ignoring a result of participation %d for commit %s", event.ParticipationID, event.CommitHash)
+		case retrigger.EventBuildFailed:
+			if event.BuildFailure == artemis.BuildFailureUnknown {
+				logger.Warn("The build failed 💥")
+			} else {
+				logger.Warnf("The build failed, most likely because of a %s 💥", event.BuildFailure)
 			}
-
-			if shouldRetrigger {
-				timer.Reset(1 * time.Second)
+			for _, entry := range event.BuildLog {
+				logger.Print("  " + entry.Log)
 			}
-		case err := <-client.WS.Errors():
-			log.Errorf("Websocket error: %s", err.Error())
-		case <-client.WS.Done():
-			log.Info("Websocket connection closed")
-			return !isExiting
 		}
 	}
 }
 
-func retriggerTask(task *artemis.Task) error {
-	log.Info("Retriggering the task... ⚙️")
-	hash, err := task.Retrigger()
-	if err != nil {
-		return err
+// Print what the run achieved to logger
+func logSummary(logger *log.Logger, runner *retrigger.Runner) {
+	stats := runner.Stats()
+	if stats.Results == 0 {
+		logger.Infof(
+			"Summary: %d retriggers, no results received, took %s",
+			stats.Retriggers,
+			time.Since(stats.StartedAt).Round(time.Second),
+		)
+		return
 	}
 
-	log.Infof("Retriggered the task with commit hash %s", hash)
-
-	return nil
+	logger.Infof(
+		"Summary: %d retriggers, %d results, last %d%%, best %d%%, took %s",
+		stats.Retriggers,
+		stats.Results,
+		stats.LastPercentage,
+		stats.BestPercentage,
+		time.Since(stats.StartedAt).Round(time.Second),
+	)
 }
 
-func handleWSMessage(client *artemis.ArtemisClient, task *artemis.Task, msg *sockjs.SockJSMessage) (error, bool) {
-	if msg.Command != "MESSAGE" {
-		return nil, false
+// Print the flaky test report of an exercise if attempts were recorded
+func logFlakyReport(logger *log.Logger, history *flaky.History, key string, desiredPercentage int) {
+	attempts, err := history.Load(key)
+	if err != nil {
+		logger.Error(err.Error())
+		return
 	}
 
-	switch msg.Headers["destination"] {
-	case "/user/topic/newSubmissions":
-		if expectingResult {
-			log.Warn("Artemis had a little hiccup and sent a new submission before the results 🤔")
-			return nil, false
-		}
-
-		log.Info("Artemis is building a new submission 📦")
-		expectingResult = true
-	case "/user/topic/newResults":
-		newPercentage := int((*msg.Body)["score"].(float64))
-		if newPercentage >= task.DesiredPercentage {
-			log.Infof("The desired percentage is reached: %d%% 🎉", newPercentage)
-			isExiting = true
-			client.Close()
-			return nil, false
-		} else {
-			log.Infof("Received new results: %d%%", newPercentage)
-		}
-
-		// Retrigger the task
-		expectingResult = false
-		return nil, true
-	default:
-		log.Debugf("Received message with unknown destination: %s", msg.Headers["destination"])
+	report := flaky.Analyze(attempts, desiredPercentage)
+	if len(report.Tests) == 0 {
+		return
 	}
 
-	return nil, false
+	logger.Info("Flaky test report 📊")
+	printFlakyReport(report)
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/config"
 )
 
 const (
@@ -41,9 +43,25 @@ by automatically handling the submission of programming exercises.`,
 		// Read config
 		initConfig()
 
+		// The profile commands only warn about a missing profile, so they can
+		// still show what is configured
+		if err := applyProfile(); err != nil {
+			if cmd.HasParent() && cmd.Parent() == profileCmd {
+				log.Warnf("Could not apply profile: %s", err.Error())
+			} else {
+				log.Errorf("Could not apply profile: %s", err.Error())
+				os.Exit(1)
+			}
+		}
+
 		// Bind config and flag values
 		bindFlags(cmd)
 
+		// Set log level
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+
 		// Initialize data directory
 		err := os.MkdirAll(viper.GetString("workdir"), 0755)
 		if err != nil {
@@ -71,6 +89,17 @@ func init() {
 	rootCmd.PersistentFlags().StringP("workdir", "d", tmpDir, "directory to store data")
 	rootCmd.PersistentFlags().BoolP("interactive", "i", false, "enter credentials interactively")
 	rootCmd.PersistentFlags().StringP("verbose", "v", "", "enable verbose logging")
+
+	rootCmd.PersistentFlags().Bool("password-stdin", false, "read the password from the first line of stdin")
+	rootCmd.PersistentFlags().String("password-command", "", "shell command that prints the password (e.g. \"pass show artemis\")")
+
+	rootCmd.PersistentFlags().String("token", "", "existing Artemis JWT to use instead of a password login (e.g. from the jwt browser cookie)")
+	rootCmd.PersistentFlags().String("token-file", "", "file containing an existing Artemis JWT")
+	rootCmd.PersistentFlags().String("vcs-token", "", "VCS access token used instead of the password for git")
+
+	rootCmd.PersistentFlags().String("instance", "", "URL of the Artemis instance (default is derived from --artemis-url or "+config.DefaultInstanceURL+")")
+	rootCmd.PersistentFlags().String("artemis-http-url", "", "override the base URL for HTTP requests (e.g. https://artemis.example.com/api)")
+	rootCmd.PersistentFlags().String("artemis-ws-url", "", "override the base URL for websocket connections (e.g. wss://artemis.example.com/websocket)")
 }
 
 func initConfig() {
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+)
+
+// Exit code used when a second signal forces the process to stop
+const forcedExitCode = 130
+
+// Return a context that is cancelled on the first SIGINT or SIGTERM
+//
+// Commands are expected to wind down cleanly once it is cancelled. A second
+// signal exits immediately without waiting for them.
+func withShutdownSignals(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			log.Warn("Shutting down gracefully, send the signal again to force exit...")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		<-signals
+		log.Error("Forced exit")
+		os.Exit(forcedExitCode)
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/util"
+	"github.com/coronon/artemisbot/internal/vault"
+)
+
+// The vault opened during this run, so the passphrase is only asked once
+var openedVault *vault.Vault
+
+// Asks for the vault passphrase if there is no passphrase command
+var promptVaultPassphrase = util.PromptSecret
+
+// credentialsCmd represents the credentials command
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage the encrypted credential vault",
+	Long: `Store usernames, passwords and tokens per Artemis host in an encrypted
+file in the workdir. The vault is protected by a passphrase, which is asked
+for on the terminal unless --vault-passphrase-command is set.`,
+}
+
+var credentialsSetCmd = &cobra.Command{
+	Use:   "set [host]",
+	Short: "Store credentials for a host (default is the configured instance)",
+	Long: `Store credentials for a host (default is the configured instance).
+
+You are asked for each value, leave it empty to keep the stored one. Remove a
+stored value with --clear-<field>, e.g. --clear-vcs-token.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		host, err := vaultHost(args)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		v, err := openVault(true)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		entry, _ := v.Get(host)
+
+		log.Infof("Enter the credentials for %s, leave a value empty to keep it", host)
+		for _, field := range []struct {
+			name   string
+			prompt string
+			value  *string
+			secret bool
+		}{
+			{"username", "Username", &entry.Username, false},
+			{"password", "Password", &entry.Password, true},
+			{"token", "Artemis token", &entry.Token, true},
+			{"vcs-token", "VCS token", &entry.VCSToken, true},
+		} {
+			if viper.GetBool("clear-" + field.name) {
+				*field.value = ""
+				continue
+			}
+
+			var input string
+			if field.secret {
+				input, err = util.PromptSecret(field.prompt + ": ")
+			} else {
+				input, err = util.PromptLine(fmt.Sprintf("%s [%s]: ", field.prompt, *field.value))
+			}
+			if err != nil {
+				log.Errorf("Could not read the %s: %s", strings.ToLower(field.prompt), err.Error())
+				return
+			}
+			if input != "" {
+				*field.value = input
+			}
+		}
+
+		v.Set(host, entry)
+		if err := v.Save(); err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		log.Infof("Stored the credentials for %s 🔒", host)
+	},
+}
+
+var credentialsGetCmd = &cobra.Command{
+	Use:   "get [host] [field]",
+	Short: "Show the credentials of a host or print a single field",
+	Long: `Show the credentials of a host (default is the configured instance) with
+secrets redacted. If a field (username, password, token or vcs-token) is given,
+only its value is printed, e.g. for use in scripts.`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		host, err := vaultHost(args)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		v, err := openVault(false)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		entry, ok := v.Get(host)
+		if !ok {
+			log.Errorf("No credentials stored for %s", host)
+			return
+		}
+
+		fields := []struct {
+			name   string
+			value  string
+			secret bool
+		}{
+			{"username", entry.Username, false},
+			{"password", entry.Password, true},
+			{"token", entry.Token, true},
+			{"vcs-token", entry.VCSToken, true},
+		}
+
+		if len(args) == 2 {
+			for _, field := range fields {
+				if field.name == args[1] {
+					fmt.Println(field.value)
+					return
+				}
+			}
+
+			log.Errorf("Unknown field %q", args[1])
+			return
+		}
+
+		fmt.Printf("Credentials for %s:\n", host)
+		for _, field := range fields {
+			value := field.value
+			if value == "" {
+				value = "-"
+			} else if field.secret {
+				value = redacted
+			}
+			fmt.Printf("  %s: %s\n", field.name, value)
+		}
+	},
+}
+
+var credentialsDeleteCmd = &cobra.Command{
+	Use:   "delete [host]",
+	Short: "Remove the credentials of a host (default is the configured instance)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		host, err := vaultHost(args)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		v, err := openVault(false)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if !v.Delete(host) {
+			log.Infof("No credentials stored for %s", host)
+			return
+		}
+		if err := v.Save(); err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		log.Infof("Removed the credentials for %s", host)
+	},
+}
+
+var credentialsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all hosts with stored credentials",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		v, err := openVault(false)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		hosts := v.Hosts()
+		if len(hosts) == 0 {
+			log.Info("No credentials stored")
+			return
+		}
+		for _, host := range hosts {
+			entry, _ := v.Get(host)
+			fmt.Printf("%s\t%s\n", host, entry.Username)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(credentialsSetCmd)
+	credentialsCmd.AddCommand(credentialsGetCmd)
+	credentialsCmd.AddCommand(credentialsDeleteCmd)
+	credentialsCmd.AddCommand(credentialsListCmd)
+
+	credentialsSetCmd.Flags().Bool("clear-username", false, "remove the stored username instead of asking for it")
+	credentialsSetCmd.Flags().Bool("clear-password", false, "remove the stored password instead of asking for it")
+	credentialsSetCmd.Flags().Bool("clear-token", false, "remove the stored Artemis token instead of asking for it")
+	credentialsSetCmd.Flags().Bool("clear-vcs-token", false, "remove the stored VCS token instead of asking for it")
+
+	rootCmd.PersistentFlags().String("vault-passphrase-command", "", "shell command that prints the passphrase of the credential vault")
+}
+
+// The host given on the command line or that of the configured instance
+func vaultHost(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	instanceConfig, err := artemisConfig(exerciseInstance(viper.GetString("artemis-url")))
+	if err != nil {
+		return "", err
+	}
+
+	return instanceConfig.Host(), nil
+}
+
+// Open the credential vault in the workdir, asking for its passphrase
+//
+// If create is false, a missing vault is an error. Otherwise the passphrase
+// of a new vault has to be confirmed.
+func openVault(create bool) (*vault.Vault, error) {
+	if openedVault != nil {
+		return openedVault, nil
+	}
+
+	workDir := viper.GetString("workdir")
+	exists := vault.Exists(workDir)
+	if !exists && !create {
+		return nil, fmt.Errorf("no credential vault in %s, create one with 'artemisbot credentials set'", workDir)
+	}
+
+	passphrase, err := readVaultPassphrase(!exists)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := vault.Open(workDir, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("could not open the credential vault: %w", err)
+	}
+
+	openedVault = v
+	return v, nil
+}
+
+// The vault entry of host, nil if there is no vault or no entry
+func vaultEntry(host string) (*vault.Entry, error) {
+	if host == "" || !vault.Exists(viper.GetString("workdir")) {
+		return nil, nil
+	}
+
+	v, err := openVault(false)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := v.Get(host)
+	if !ok {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// The vault entry of host if the vault is open already, nil otherwise
+//
+// Used for optional lookups that must not ask for the passphrase.
+func openedVaultEntry(host string) *vault.Entry {
+	if openedVault == nil || host == "" {
+		return nil
+	}
+
+	entry, ok := openedVault.Get(host)
+	if !ok {
+		return nil
+	}
+
+	return &entry
+}
+
+// Get the vault passphrase from --vault-passphrase-command or the terminal
+func readVaultPassphrase(confirm bool) (string, error) {
+	if command := viper.GetString("vault-passphrase-command"); command != "" {
+		return util.RunPasswordCommand(rootCmd.Context(), command)
+	}
+
+	passphrase, err := promptVaultPassphrase("Vault passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("could not read the vault passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the vault passphrase must not be empty")
+	}
+
+	if confirm {
+		repeated, err := promptVaultPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return "", fmt.Errorf("could not read the vault passphrase: %w", err)
+		}
+		if repeated != passphrase {
+			return "", fmt.Errorf("the passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
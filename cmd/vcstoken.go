@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// Number of characters of a token shown by list and show
+const tokenPrefixLength = 8
+
+// vcsTokenCmd represents the vcs-token command
+var vcsTokenCmd = &cobra.Command{
+	Use:   "vcs-token",
+	Short: "Manage Artemis VCS access tokens",
+	Long: `VCS access tokens replace the password for git. Use one with --vcs-token,
+store it in the credential vault or let retrigger fetch the token of the
+participation with --fetch-vcs-token.`,
+}
+
+var vcsTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your VCS access tokens and when they expire",
+	Long: `List your personal VCS access token and, if --artemis-url points to an
+exercise, the token of your participation.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := newAPIClient(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		participationIDs := []int{}
+		if exerciseURL := viper.GetString("artemis-url"); exerciseInstance(exerciseURL) != "" {
+			matches := artemisURLRegex.FindStringSubmatch(exerciseURL)
+			details, err := client.GetExerciseDetails(cmd.Context(), matches[3])
+			if err != nil {
+				log.Error(err.Error())
+				return
+			}
+			for _, participation := range details.StudentParticipations {
+				participationIDs = append(participationIDs, participation.ID)
+			}
+		}
+
+		tokens, err := client.ListVCSAccessTokens(cmd.Context(), participationIDs...)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(tokens) == 0 {
+			log.Info("No VCS access tokens")
+			return
+		}
+
+		for _, token := range tokens {
+			printVCSToken(token, false)
+		}
+	},
+}
+
+var vcsTokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a personal VCS access token, replacing the current one",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validFor := viper.GetDuration("valid-for")
+		if validFor <= 0 {
+			log.Error("The validity must be positive")
+			return
+		}
+
+		client, err := newAPIClient(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		token, err := client.CreateVCSAccessToken(cmd.Context(), time.Now().Add(validFor))
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		log.Info("Created a new VCS access token, store it now as it is shown only once")
+		printVCSToken(token, true)
+	},
+}
+
+var vcsTokenShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show when your personal VCS access token expires",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := newAPIClient(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		tokens, err := client.ListVCSAccessTokens(cmd.Context())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(tokens) == 0 {
+			log.Info("You have no personal VCS access token, create one with 'artemisbot vcs-token create'")
+			return
+		}
+
+		token := tokens[0]
+		printVCSToken(token, false)
+		if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+			log.Warn("The token has expired")
+		} else if !token.Expiry.IsZero() {
+			log.Infof("The token expires in %s", time.Until(token.Expiry).Round(time.Hour))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vcsTokenCmd)
+	vcsTokenCmd.AddCommand(vcsTokenListCmd)
+	vcsTokenCmd.AddCommand(vcsTokenCreateCmd)
+	vcsTokenCmd.AddCommand(vcsTokenShowCmd)
+
+	vcsTokenCmd.PersistentFlags().StringP("artemis-url", "t", "", "URL of an Artemis exercise to include the participation token of")
+	vcsTokenCreateCmd.Flags().Duration("valid-for", 30*24*time.Hour, "how long the new token is valid")
+}
+
+func printVCSToken(token *artemis.VCSAccessToken, reveal bool) {
+	value := token.Token
+	if !reveal && len(value) > tokenPrefixLength {
+		value = value[:tokenPrefixLength] + "…"
+	}
+
+	expiry := "never"
+	if !token.Expiry.IsZero() {
+		expiry = token.Expiry.Local().Format(time.DateTime)
+	}
+
+	if token.Kind == artemis.VCSTokenParticipation {
+		fmt.Printf("%s %d\t%s\texpires %s\n", token.Kind, token.ParticipationID, value, expiry)
+		return
+	}
+	fmt.Printf("%s\t%s\texpires %s\n", token.Kind, value, expiry)
+}
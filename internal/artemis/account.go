@@ -0,0 +1,183 @@
+package artemis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Account struct {
+	ID        int    `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	// Only set if the user created a personal VCS access token
+	VCSAccessToken           string     `json:"vcsAccessToken"`
+	VCSAccessTokenExpiryDate *time.Time `json:"vcsAccessTokenExpiryDate"`
+}
+
+// Kinds of VCS access tokens
+const (
+	// A personal token that works for all repositories of the user
+	VCSTokenUser = "user"
+	// A token that only works for the repository of one participation
+	VCSTokenParticipation = "participation"
+)
+
+// Prefix of all VCS access tokens Artemis issues
+const vcsAccessTokenPrefix = "vcpat-"
+
+type VCSAccessToken struct {
+	Kind  string
+	Token string
+	// Zero if the token does not expire
+	Expiry time.Time
+	// Only set for participation tokens
+	ParticipationID int
+}
+
+// Get the account of the logged in user
+func (c *ArtemisClient) GetAccount(ctx context.Context) (*Account, error) {
+	var account Account
+	resp, err := c.HTTP.R().
+		SetContext(ctx).
+		SetResult(&account).
+		Get(c.Config.ArtemisHttpURL + "/public/account")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to get account: %s", resp.Status())
+	}
+
+	return &account, nil
+}
+
+// List the VCS access tokens of the user
+//
+// Participation tokens are only looked up for the given participations.
+func (c *ArtemisClient) ListVCSAccessTokens(ctx context.Context, participationIDs ...int) ([]*VCSAccessToken, error) {
+	tokens := []*VCSAccessToken{}
+
+	account, err := c.GetAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if account.VCSAccessToken != "" {
+		token := &VCSAccessToken{
+			Kind:  VCSTokenUser,
+			Token: account.VCSAccessToken,
+		}
+		if account.VCSAccessTokenExpiryDate != nil {
+			token.Expiry = *account.VCSAccessTokenExpiryDate
+		}
+		tokens = append(tokens, token)
+	}
+
+	for _, participationID := range participationIDs {
+		token, err := c.getParticipationVCSAccessToken(ctx, participationID)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Create a personal VCS access token, replacing the previous one
+func (c *ArtemisClient) CreateVCSAccessToken(ctx context.Context, expiry time.Time) (*VCSAccessToken, error) {
+	var account Account
+	resp, err := c.HTTP.R().
+		SetContext(ctx).
+		SetQueryParam("expiryDate", expiry.UTC().Format(time.RFC3339)).
+		SetResult(&account).
+		Put(c.Config.ArtemisHttpURL + "/account/user-vcs-access-token")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to create a VCS access token: %s", resp.Status())
+	}
+	if account.VCSAccessToken == "" {
+		return nil, fmt.Errorf("Artemis did not return the new VCS access token")
+	}
+
+	token := &VCSAccessToken{
+		Kind:  VCSTokenUser,
+		Token: account.VCSAccessToken,
+	}
+	if account.VCSAccessTokenExpiryDate != nil {
+		token.Expiry = *account.VCSAccessTokenExpiryDate
+	}
+
+	return token, nil
+}
+
+// Get the VCS access token of a participation, creating it if necessary
+func (c *ArtemisClient) GetParticipationVCSAccessToken(ctx context.Context, participationID int) (*VCSAccessToken, error) {
+	token, err := c.getParticipationVCSAccessToken(ctx, participationID)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	resp, err := c.HTTP.R().
+		SetContext(ctx).
+		SetQueryParam("participationId", fmt.Sprint(participationID)).
+		Put(c.Config.ArtemisHttpURL + "/account/participation-vcs-access-token")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to create a VCS access token: %s", resp.Status())
+	}
+
+	return &VCSAccessToken{
+		Kind:            VCSTokenParticipation,
+		Token:           plainToken(resp.String()),
+		ParticipationID: participationID,
+	}, nil
+}
+
+// Get the VCS access token of a participation, nil if there is none yet
+func (c *ArtemisClient) getParticipationVCSAccessToken(ctx context.Context, participationID int) (*VCSAccessToken, error) {
+	resp, err := c.HTTP.R().
+		SetContext(ctx).
+		SetQueryParam("participationId", fmt.Sprint(participationID)).
+		Get(c.Config.ArtemisHttpURL + "/account/participation-vcs-access-token")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to get the VCS access token: %s", resp.Status())
+	}
+
+	return &VCSAccessToken{
+		Kind:            VCSTokenParticipation,
+		Token:           plainToken(resp.String()),
+		ParticipationID: participationID,
+	}, nil
+}
+
+// Artemis returns tokens as plain text, possibly JSON quoted
+func plainToken(body string) string {
+	return strings.Trim(strings.TrimSpace(body), `"`)
+}
+
+// Whether secret is an Artemis VCS access token rather than a password
+func IsVCSAccessToken(secret string) bool {
+	return strings.HasPrefix(secret, vcsAccessTokenPrefix)
+}
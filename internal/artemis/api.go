@@ -1,11 +1,9 @@
 package artemis
 
 import (
+	"context"
 	"fmt"
 	"time"
-
-	"github.com/coronon/artemisbot/internal/config"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthenticateRequest struct {
@@ -15,11 +13,12 @@ type AuthenticateRequest struct {
 }
 
 // Authenticate with Artemis and store the JWT in the client
-func (c *ArtemisClient) Authenticate(req *AuthenticateRequest) error {
+func (c *ArtemisClient) Authenticate(ctx context.Context, req *AuthenticateRequest) error {
 	_, err, _ := c.sf.Do("authenticate", func() (interface{}, error) {
 		resp, err := c.HTTP.R().
+			SetContext(ctx).
 			SetBody(req).
-			Post(config.C.ArtemisHttpURL + "/public/authenticate")
+			Post(c.Config.ArtemisHttpURL + "/public/authenticate")
 		if err != nil {
 			return nil, err
 		}
@@ -40,13 +39,13 @@ func (c *ArtemisClient) Authenticate(req *AuthenticateRequest) error {
 			return nil, fmt.Errorf("no JWT found in response")
 		}
 
-		token, _, err := jwt.NewParser().ParseUnverified(foundJWT, &jwt.RegisteredClaims{})
+		token, err := parseJWT(foundJWT)
 		if err != nil {
 			return nil, err
 		}
-		token.Valid = true
 
-		c.jwt = token
+		c.setSession(token)
+		c.cacheToken()
 
 		return nil, nil
 	})
@@ -191,14 +190,15 @@ type ExerciseDetails struct {
 }
 
 // Get the details of an exercise on Artemis by its ID
-func (c *ArtemisClient) GetExerciseDetails(exerciseID string) (*ExerciseDetails, error) {
+func (c *ArtemisClient) GetExerciseDetails(ctx context.Context, exerciseID string) (*ExerciseDetails, error) {
 	details, err, _ := c.sf.Do(fmt.Sprintf("exercise-details-%s", exerciseID), func() (interface{}, error) {
 		var details ExerciseDetails
 		resp, err := c.HTTP.R().
+			SetContext(ctx).
 			SetResult(&details).
 			Get(fmt.Sprintf(
 				"%s/exercises/%s/details",
-				config.C.ArtemisHttpURL,
+				c.Config.ArtemisHttpURL,
 				exerciseID,
 			))
 		if err != nil {
@@ -211,6 +211,9 @@ func (c *ArtemisClient) GetExerciseDetails(exerciseID string) (*ExerciseDetails,
 
 		return &details, nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return details.(*ExerciseDetails), err
+	return details.(*ExerciseDetails), nil
 }
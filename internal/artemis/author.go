@@ -0,0 +1,71 @@
+package artemis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Author used when nothing else is configured
+const (
+	DefaultAuthorName  = "{name}"
+	DefaultAuthorEmail = "{email}"
+)
+
+// How the author of retrigger commits is chosen
+//
+// Name and Email may contain the placeholders {login}, {name}, {firstName},
+// {lastName} and {email}, which are replaced with the fields of the Artemis
+// account. Empty values use the name and email of the account.
+type AuthorConfig struct {
+	Name  string
+	Email string
+}
+
+// Whether the account has to be fetched to build the author
+func (c AuthorConfig) needsAccount() bool {
+	return c.Name == "" || c.Email == "" || strings.Contains(c.Name+c.Email, "{")
+}
+
+// Build the name and email of the commit author for account
+//
+// account may be nil if needsAccount is false.
+func (c AuthorConfig) author(account *Account) (string, string, error) {
+	nameTemplate := c.Name
+	if nameTemplate == "" {
+		nameTemplate = DefaultAuthorName
+	}
+	emailTemplate := c.Email
+	if emailTemplate == "" {
+		emailTemplate = DefaultAuthorEmail
+	}
+
+	replacer := strings.NewReplacer()
+	if account != nil {
+		name := account.Name
+		if name == "" {
+			name = strings.TrimSpace(account.FirstName + " " + account.LastName)
+		}
+		if name == "" {
+			name = account.Login
+		}
+
+		replacer = strings.NewReplacer(
+			"{login}", account.Login,
+			"{name}", name,
+			"{firstName}", account.FirstName,
+			"{lastName}", account.LastName,
+			"{email}", account.Email,
+		)
+	}
+
+	name := strings.TrimSpace(replacer.Replace(nameTemplate))
+	email := strings.TrimSpace(replacer.Replace(emailTemplate))
+	if name == "" {
+		return "", "", fmt.Errorf("the commit author has no name, set one with --author-name")
+	}
+	if email == "" {
+		return "", "", fmt.Errorf("the commit author has no email, set one with --author-email")
+	}
+
+	return name, email, nil
+}
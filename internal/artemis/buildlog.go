@@ -0,0 +1,136 @@
+package artemis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// One line of the build log of a submission
+type BuildLogEntry struct {
+	ID   int        `json:"id"`
+	Time *time.Time `json:"time"`
+	Log  string     `json:"log"`
+}
+
+// Why a build failed, guessed from its log
+type BuildFailure int
+
+const (
+	// Nothing in the log hints at the cause
+	BuildFailureUnknown BuildFailure = iota
+	// The submitted code does not compile, retriggering will not help
+	BuildFailureCompilation
+	// The build server had a problem, retriggering may help
+	BuildFailureInfrastructure
+)
+
+func (f BuildFailure) String() string {
+	switch f {
+	case BuildFailureCompilation:
+		return "compilation error"
+	case BuildFailureInfrastructure:
+		return "infrastructure problem"
+	default:
+		return "unknown"
+	}
+}
+
+// Lines that only show up when the code does not compile
+var compilationErrorMarkers = []string{
+	"COMPILATION ERROR",
+	"Compilation failure",
+	"Compilation failed",
+	"compileJava FAILED",
+	"compileKotlin FAILED",
+	"cannot find symbol",
+	"error: expected",
+	"SyntaxError:",
+	"undefined reference to",
+	"error[E",
+}
+
+// Lines that point at the build server instead of the code
+var infrastructureErrorMarkers = []string{
+	"Could not resolve dependencies",
+	"Could not transfer artifact",
+	"Could not resolve all",
+	"Connection refused",
+	"Connection reset",
+	"Connection timed out",
+	"Read timed out",
+	"No space left on device",
+	"Cannot connect to the Docker daemon",
+	"toomanyrequests",
+	"The build was aborted",
+	"Build timed out",
+}
+
+// Get the build log of the latest submission of a participation
+//
+// resultID selects the build of a specific result if it is not zero.
+func (c *ArtemisClient) GetBuildLogs(ctx context.Context, participationID, resultID int) ([]*BuildLogEntry, error) {
+	var entries []*BuildLogEntry
+	request := c.HTTP.R().
+		SetContext(ctx).
+		SetResult(&entries)
+	if resultID != 0 {
+		request.SetQueryParam("resultId", fmt.Sprint(resultID))
+	}
+
+	resp, err := request.Get(fmt.Sprintf("%s/repository/%d/buildlogs", c.Config.ArtemisHttpURL, participationID))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to get the build logs: %s", resp.Status())
+	}
+
+	return entries, nil
+}
+
+// Guess why a build failed from its log
+//
+// Compilation errors win over infrastructure problems, as a broken build
+// server rarely gets as far as compiling.
+func ClassifyBuildLog(entries []*BuildLogEntry) BuildFailure {
+	if firstLineWith(entries, compilationErrorMarkers) >= 0 {
+		return BuildFailureCompilation
+	}
+	if firstLineWith(entries, infrastructureErrorMarkers) >= 0 {
+		return BuildFailureInfrastructure
+	}
+
+	return BuildFailureUnknown
+}
+
+// The part of a build log that explains the failure, at most n lines
+//
+// This starts at the first line hinting at the cause and falls back to the
+// end of the log.
+func RelevantBuildLog(entries []*BuildLogEntry, n int) []*BuildLogEntry {
+	start := firstLineWith(entries, compilationErrorMarkers)
+	if start < 0 {
+		start = firstLineWith(entries, infrastructureErrorMarkers)
+	}
+	if start < 0 || len(entries)-start < n {
+		start = max(len(entries)-n, 0)
+	}
+
+	return entries[start:min(start+n, len(entries))]
+}
+
+// The index of the first entry containing one of markers, -1 if none does
+func firstLineWith(entries []*BuildLogEntry, markers []string) int {
+	for i, entry := range entries {
+		for _, marker := range markers {
+			if strings.Contains(entry.Log, marker) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
@@ -1,9 +1,11 @@
 package artemis
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -15,106 +17,381 @@ import (
 	"github.com/coronon/artemisbot/internal/sockjs"
 )
 
+const (
+	// How long to wait for the server to acknowledge a websocket DISCONNECT
+	disconnectTimeout = 3 * time.Second
+	// Tokens expiring sooner than this are treated as expired already
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// A token supplied with UseToken can no longer be used and cannot be renewed
+type TokenExpiredError struct {
+	// Zero if the token was rejected before it expired
+	Expiry time.Time
+}
+
+func (e *TokenExpiredError) Error() string {
+	if e.Expiry.IsZero() {
+		return "the supplied Artemis token was rejected, please supply a new one"
+	}
+
+	return fmt.Sprintf("the supplied Artemis token expired at %s, please supply a new one", e.Expiry.Local().Format(time.DateTime))
+}
+
 type ArtemisClient struct {
 	sf singleflight.Group
 
+	// The Artemis instance this client talks to
+	Config *config.Config
+
 	Username string
 	password string
 
-	jwt  *jwt.Token
-	HTTP *resty.Client
-	WS   *sockjs.SockJSClient
+	// Guards jwt, the client may be shared by several runners
+	jwtMtx sync.RWMutex
+	jwt    *jwt.Token
+	// The JWT was supplied by the user and cannot be renewed
+	staticToken bool
+	HTTP        *resty.Client
+	WS          *sockjs.SockJSClient
 
 	// Absolute path to the working directory
 	WorkDir string
+	tokens  *TokenCache
 }
 
-// Create a new authenticated Artemis client
-func NewArtemisClient(username, password, workdir string) (*ArtemisClient, error) {
-	client := ArtemisClient{
+// Create an Artemis client for HTTP requests without logging in yet
+//
+// Requests log in on demand, preferring a JWT cached in the working
+// directory over a password login.
+func NewArtemisHTTPClient(cfg *config.Config, username, password, workdir string) *ArtemisClient {
+	client := &ArtemisClient{
 		sf: singleflight.Group{},
 
+		Config: cfg,
+
 		Username: username,
 		password: password,
 
 		WorkDir: workdir,
+		tokens:  NewTokenCache(workdir),
 	}
 
 	client.HTTP = resty.New().
-		OnBeforeRequest(buildClientAuthMiddleware(&client))
+		OnBeforeRequest(buildClientAuthMiddleware(client)).
+		OnAfterResponse(buildClientSessionMiddleware(client))
 
-	log.Debug("Trying to authenticate with Artemis...")
-	err := client.Authenticate(&AuthenticateRequest{
-		Username:     username,
-		Password:     password,
-		RemememberMe: true,
-	})
-	if err != nil {
+	return client
+}
+
+// Create a new authenticated Artemis client
+func NewArtemisClient(ctx context.Context, cfg *config.Config, username, password, workdir string) (*ArtemisClient, error) {
+	client := NewArtemisHTTPClient(cfg, username, password, workdir)
+
+	if err := client.Login(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := client.ConnectWebsocket(ctx); err != nil {
 		return nil, err
 	}
+
+	return client, nil
+}
+
+// Make sure the client is authenticated
+//
+// A still valid JWT from the token cache is reused, otherwise we log in
+// with the password.
+func (c *ArtemisClient) Login(ctx context.Context) error {
+	if c.IsAuthenticated() {
+		return nil
+	}
+
+	if c.loadCachedToken() {
+		log.Debug("Reusing the cached Artemis session")
+		return nil
+	}
+
+	log.Debug("Trying to authenticate with Artemis...")
+	if err := c.Reauthenticate(ctx); err != nil {
+		return err
+	}
 	log.Debug("Successfully authenticated with Artemis")
 
+	return nil
+}
+
+// Authenticate with an existing JWT instead of a password
+//
+// This is meant for instances that only allow logging in through SSO in the
+// browser, where the token can be copied from the jwt cookie. The token is
+// used as is and never cached or renewed, so it must not have expired.
+func (c *ArtemisClient) UseToken(raw string) error {
+	token, err := parseJWT(normalizeToken(raw))
+	if err != nil {
+		return fmt.Errorf("invalid Artemis token: %w", err)
+	}
+
+	expiryTime, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		return fmt.Errorf("invalid Artemis token: %w", err)
+	}
+	if expiryTime == nil {
+		return fmt.Errorf("invalid Artemis token: missing expiry")
+	}
+	if expiryTime.Before(time.Now().Add(tokenExpiryMargin)) {
+		return fmt.Errorf("the supplied Artemis token expired at %s", expiryTime.Local().Format(time.DateTime))
+	}
+
+	if c.Username == "" {
+		if c.Username, err = token.Claims.GetSubject(); err != nil {
+			return fmt.Errorf("invalid Artemis token: %w", err)
+		}
+	}
+
+	c.setSession(token)
+	c.staticToken = true
+
+	return nil
+}
+
+// Forget the current session and remove it from the token cache
+//
+// Returns false if no session was cached.
+func (c *ArtemisClient) Logout() (bool, error) {
+	c.setSession(nil)
+
+	return c.tokens.Delete(c.tokenCacheKey())
+}
+
+// The expiry of the current session, zero if not authenticated
+func (c *ArtemisClient) SessionExpiry() time.Time {
+	token := c.session()
+	if token == nil {
+		return time.Time{}
+	}
+
+	expiryTime, err := token.Claims.GetExpirationTime()
+	if err != nil || expiryTime == nil {
+		return time.Time{}
+	}
+
+	return expiryTime.Time
+}
+
+// Use the cached JWT if there is one that is still valid
+func (c *ArtemisClient) loadCachedToken() bool {
+	raw, err := c.tokens.Load(c.tokenCacheKey())
+	if err != nil {
+		log.Warnf("Could not load the cached Artemis session: %s", err.Error())
+		return false
+	}
+	if raw == "" {
+		return false
+	}
+
+	token, err := parseJWT(raw)
+	if err != nil {
+		log.Debugf("Ignoring an invalid cached Artemis session: %s", err.Error())
+		return false
+	}
+
+	if !tokenValid(token) {
+		log.Debug("The cached Artemis session expired")
+		return false
+	}
+	c.setSession(token)
+
+	return true
+}
+
+// Store the current JWT for later runs
+func (c *ArtemisClient) cacheToken() {
+	token := c.session()
+	if token == nil {
+		return
+	}
+
+	if err := c.tokens.Store(c.tokenCacheKey(), token.Raw); err != nil {
+		log.Warnf("Could not cache the Artemis session: %s", err.Error())
+	}
+}
+
+func (c *ArtemisClient) tokenCacheKey() string {
+	return tokenCacheKey(c.Config.ArtemisHttpURL, c.Username)
+}
+
+// Connect (or reconnect) the websocket, replacing any previous connection
+//
+// Subscriptions are bound to a connection and have to be renewed afterwards.
+func (c *ArtemisClient) ConnectWebsocket(ctx context.Context) error {
+	if c.WS != nil {
+		c.WS.Close()
+	}
+
+	if !c.IsAuthenticated() {
+		if err := c.Reauthenticate(ctx); err != nil {
+			return err
+		}
+	}
+
 	log.Debug("Creating websocket connection to Artemis...")
-	wsHeaders := http.Header{}
-	wsHeaders.Add("Origin", config.C.ArtemisHttpURL)
-	wsHeaders.Add("Cookie", fmt.Sprintf("jwt=%s", client.jwt.Raw))
 	wsClient, err := sockjs.NewSockJSClient(
-		fmt.Sprintf("%s/0/a/websocket", config.C.ArtemisWsURL),
-		wsHeaders,
+		ctx,
+		fmt.Sprintf("%s/0/a/websocket", c.Config.ArtemisWsURL),
+		c.websocketHeaders(),
+		&sockjs.Options{
+			Reconnect: sockjs.DefaultReconnectPolicy(),
+			Heartbeat: &sockjs.HeartbeatPolicy{
+				Send:      10 * time.Second,
+				Receive:   10 * time.Second,
+				Tolerance: 3,
+				OnStale:   sockjs.StaleReconnect,
+			},
+			RefreshHeaders: func(ctx context.Context) (http.Header, error) {
+				if !c.IsAuthenticated() {
+					if err := c.Reauthenticate(ctx); err != nil {
+						return nil, err
+					}
+				}
+
+				return c.websocketHeaders(), nil
+			},
+		},
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	client.WS = wsClient
+	c.WS = wsClient
 	log.Debug("Successfully connected to Artemis websocket")
 
-	return &client, nil
+	return nil
+}
+
+// Build the headers for the websocket handshake from the current JWT
+func (c *ArtemisClient) websocketHeaders() http.Header {
+	wsHeaders := http.Header{}
+	wsHeaders.Add("Origin", c.Config.Origin())
+	if token := c.session(); token != nil {
+		wsHeaders.Add("Cookie", fmt.Sprintf("jwt=%s", token.Raw))
+	}
+
+	return wsHeaders
+}
+
+// Discard the current JWT and log in again with the stored credentials
+func (c *ArtemisClient) Reauthenticate(ctx context.Context) error {
+	if c.staticToken {
+		err := &TokenExpiredError{Expiry: c.SessionExpiry()}
+		c.setSession(nil)
+		return err
+	}
+
+	c.setSession(nil)
+	if c.password == "" {
+		return fmt.Errorf("the Artemis session expired and no password is available, run 'artemisbot login'")
+	}
+
+	return c.Authenticate(ctx, &AuthenticateRequest{
+		Username:     c.Username,
+		Password:     c.password,
+		RemememberMe: true,
+	})
 }
 
 // Shutdown the Artemis client (mainly the websocket connection)
+//
+// The STOMP session is ended with a DISCONNECT, waiting a few seconds at
+// most for the server to acknowledge it.
 func (c *ArtemisClient) Close() {
-	c.WS.Close()
+	if c.WS == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+
+	if err := c.WS.Disconnect(ctx); err != nil {
+		log.Debugf("Could not disconnect the websocket cleanly: %s", err.Error())
+	}
 }
 
 // Check if the client is authenticated
 func (c *ArtemisClient) IsAuthenticated() bool {
-	if c.jwt == nil {
+	return tokenValid(c.session())
+}
+
+// The current JWT, nil if not authenticated
+func (c *ArtemisClient) session() *jwt.Token {
+	c.jwtMtx.RLock()
+	defer c.jwtMtx.RUnlock()
+
+	return c.jwt
+}
+
+func (c *ArtemisClient) setSession(token *jwt.Token) {
+	c.jwtMtx.Lock()
+	defer c.jwtMtx.Unlock()
+
+	c.jwt = token
+}
+
+// Check that a JWT does not expire too soon to be used
+func tokenValid(token *jwt.Token) bool {
+	if token == nil {
 		return false
 	}
 
-	expiryTime, err := c.jwt.Claims.GetExpirationTime()
-	if err != nil {
+	expiryTime, err := token.Claims.GetExpirationTime()
+	if err != nil || expiryTime == nil {
 		return false
 	}
 
-	return expiryTime.After(time.Now().Add(30 * time.Second))
+	return expiryTime.After(time.Now().Add(tokenExpiryMargin))
 }
 
 func buildClientAuthMiddleware(artemisClient *ArtemisClient) resty.RequestMiddleware {
 	return func(restyClient *resty.Client, request *resty.Request) error {
-		if request.URL == config.C.ArtemisHttpURL+"/public/authenticate" {
+		if request.URL == artemisClient.Config.ArtemisHttpURL+"/public/authenticate" {
 			return nil
 		}
 
 		if !artemisClient.IsAuthenticated() {
-			err := artemisClient.Authenticate(&AuthenticateRequest{
-				Username: artemisClient.Username,
-				Password: artemisClient.password,
-			})
-			if err != nil {
+			if err := artemisClient.Reauthenticate(request.Context()); err != nil {
 				return err
 			}
 		}
 
+		token := artemisClient.session()
+		if token == nil {
+			return fmt.Errorf("not authenticated with Artemis")
+		}
 		request.SetCookie(&http.Cookie{
 			Name:  "jwt",
-			Value: artemisClient.jwt.Raw,
+			Value: token.Raw,
 		})
 
 		return nil
 	}
 }
 
+// Drop sessions that Artemis no longer accepts so the next request logs in again
+func buildClientSessionMiddleware(artemisClient *ArtemisClient) resty.ResponseMiddleware {
+	return func(restyClient *resty.Client, response *resty.Response) error {
+		if response.StatusCode() != http.StatusUnauthorized || artemisClient.session() == nil {
+			return nil
+		}
+
+		log.Debug("Artemis rejected the session, discarding it")
+		if _, err := artemisClient.Logout(); err != nil {
+			log.Warnf("Could not remove the cached Artemis session: %s", err.Error())
+		}
+
+		return nil
+	}
+}
+
 // Get the path to a new temporary directory and optionally create it
 //
 // The directory containing this path is guaranteed to exist.
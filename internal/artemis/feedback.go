@@ -0,0 +1,198 @@
+package artemis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefixes Artemis puts in front of the text of non-test feedback
+const (
+	scaFeedbackPrefix              = "SCAFeedbackIdentifier^"
+	submissionPolicyFeedbackPrefix = "SubPolFeedbackIdentifier"
+)
+
+// A single feedback item of a result as returned by Artemis
+type Feedback struct {
+	ID         int     `json:"id"`
+	Text       string  `json:"text"`
+	DetailText string  `json:"detailText"`
+	Reference  string  `json:"reference"`
+	Credits    float64 `json:"credits"`
+	Positive   *bool   `json:"positive"`
+	Type       string  `json:"type"`
+	TestCase   *struct {
+		ID       int    `json:"id"`
+		TestName string `json:"testName"`
+	} `json:"testCase"`
+}
+
+// The outcome of one test case
+type TestFeedback struct {
+	Name    string  `json:"name"`
+	Passed  bool    `json:"passed"`
+	Credits float64 `json:"credits"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// An issue found by static code analysis
+type CodeIssue struct {
+	File      string  `json:"file"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Rule      string  `json:"rule,omitempty"`
+	Category  string  `json:"category,omitempty"`
+	Message   string  `json:"message"`
+	Priority  string  `json:"priority,omitempty"`
+	Penalty   float64 `json:"penalty,omitempty"`
+}
+
+// Feedback that is neither a test nor a code issue, e.g. from a tutor
+type FeedbackComment struct {
+	Text    string  `json:"text"`
+	Detail  string  `json:"detail,omitempty"`
+	Credits float64 `json:"credits"`
+}
+
+// The detailed feedback of a result
+type ResultFeedback struct {
+	ParticipationID int               `json:"participationId"`
+	ResultID        int               `json:"resultId"`
+	Score           float64           `json:"score"`
+	Tests           []TestFeedback    `json:"tests"`
+	Issues          []CodeIssue       `json:"issues"`
+	Comments        []FeedbackComment `json:"comments"`
+}
+
+// Number of passed tests
+func (f *ResultFeedback) PassedTests() int {
+	passed := 0
+	for _, test := range f.Tests {
+		if test.Passed {
+			passed++
+		}
+	}
+
+	return passed
+}
+
+// Get the feedback items of a result
+func (c *ArtemisClient) GetResultDetails(ctx context.Context, participationID, resultID int) ([]*Feedback, error) {
+	var feedbacks []*Feedback
+	resp, err := c.HTTP.R().
+		SetContext(ctx).
+		SetResult(&feedbacks).
+		Get(fmt.Sprintf(
+			"%s/participations/%d/results/%d/details",
+			c.Config.ArtemisHttpURL,
+			participationID,
+			resultID,
+		))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to get the feedback of result %d: %s", resultID, resp.Status())
+	}
+
+	return feedbacks, nil
+}
+
+// Get the feedback of a result split into tests, code issues and comments
+func (c *ArtemisClient) GetResultFeedback(ctx context.Context, participationID, resultID int) (*ResultFeedback, error) {
+	feedbacks, err := c.GetResultDetails(ctx, participationID, resultID)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := ParseFeedback(feedbacks)
+	feedback.ParticipationID = participationID
+	feedback.ResultID = resultID
+
+	return feedback, nil
+}
+
+// Sort feedback items into tests, code issues and comments
+//
+// Tests are sorted by name and issues by file and line.
+func ParseFeedback(feedbacks []*Feedback) *ResultFeedback {
+	result := &ResultFeedback{
+		Tests:    []TestFeedback{},
+		Issues:   []CodeIssue{},
+		Comments: []FeedbackComment{},
+	}
+
+	for _, feedback := range feedbacks {
+		switch {
+		case strings.HasPrefix(feedback.Text, scaFeedbackPrefix):
+			result.Issues = append(result.Issues, parseCodeIssue(feedback))
+		case feedback.TestCase != nil && feedback.TestCase.TestName != "":
+			result.Tests = append(result.Tests, TestFeedback{
+				Name:    feedback.TestCase.TestName,
+				Passed:  feedback.Positive != nil && *feedback.Positive,
+				Credits: feedback.Credits,
+				Detail:  feedback.DetailText,
+			})
+		case feedback.Type == "AUTOMATIC" && !strings.HasPrefix(feedback.Text, submissionPolicyFeedbackPrefix):
+			// Older Artemis versions only put the test name into the text
+			result.Tests = append(result.Tests, TestFeedback{
+				Name:    feedback.Text,
+				Passed:  feedback.Positive != nil && *feedback.Positive,
+				Credits: feedback.Credits,
+				Detail:  feedback.DetailText,
+			})
+		default:
+			result.Comments = append(result.Comments, FeedbackComment{
+				Text:    strings.TrimPrefix(feedback.Text, submissionPolicyFeedbackPrefix),
+				Detail:  feedback.DetailText,
+				Credits: feedback.Credits,
+			})
+		}
+	}
+
+	sort.SliceStable(result.Tests, func(i, j int) bool {
+		return result.Tests[i].Name < result.Tests[j].Name
+	})
+	sort.SliceStable(result.Issues, func(i, j int) bool {
+		if result.Issues[i].File != result.Issues[j].File {
+			return result.Issues[i].File < result.Issues[j].File
+		}
+		return result.Issues[i].StartLine < result.Issues[j].StartLine
+	})
+
+	return result
+}
+
+// Static code analysis issues are sent as JSON in the detail text
+func parseCodeIssue(feedback *Feedback) CodeIssue {
+	var issue struct {
+		FilePath  string  `json:"filePath"`
+		StartLine int     `json:"startLine"`
+		EndLine   int     `json:"endLine"`
+		Rule      string  `json:"rule"`
+		Category  string  `json:"category"`
+		Message   string  `json:"message"`
+		Priority  string  `json:"priority"`
+		Penalty   float64 `json:"penalty"`
+	}
+	if err := json.Unmarshal([]byte(feedback.DetailText), &issue); err != nil {
+		return CodeIssue{
+			Category: strings.TrimPrefix(feedback.Text, scaFeedbackPrefix),
+			Message:  feedback.DetailText,
+		}
+	}
+
+	return CodeIssue{
+		File:      issue.FilePath,
+		StartLine: issue.StartLine,
+		EndLine:   issue.EndLine,
+		Rule:      issue.Rule,
+		Category:  issue.Category,
+		Message:   issue.Message,
+		Priority:  issue.Priority,
+		Penalty:   issue.Penalty,
+	}
+}
@@ -16,3 +16,13 @@ func (d *ExerciseDetails) GetMostRecentScore() int {
 
 	return mostRecentScore
 }
+
+// The ID of the most recent result, zero if there is none
+func (d *ExerciseDetails) GetMostRecentResultID() int {
+	var mostRecentID int
+	for _, result := range d.StudentParticipations[0].Results {
+		mostRecentID = max(mostRecentID, result.ID)
+	}
+
+	return mostRecentID
+}
@@ -0,0 +1,92 @@
+package artemis
+
+import (
+	"time"
+)
+
+// Websocket topics Artemis publishes build events of the user to
+const (
+	TopicNewSubmissions = "/user/topic/newSubmissions"
+	TopicNewResults     = "/user/topic/newResults"
+)
+
+// The participation a submission or result belongs to
+//
+// Artemis sends the whole participation, only its ID is of interest here.
+type ParticipationRef struct {
+	ID int `json:"id"`
+}
+
+// A programming submission as sent to /user/topic/newSubmissions
+//
+// Newer Artemis versions only send the IDs of the participation and exercise
+// instead of the participation, so both forms are accepted.
+type Submission struct {
+	ID             int               `json:"id"`
+	SubmissionDate *time.Time        `json:"submissionDate"`
+	CommitHash     string            `json:"commitHash"`
+	BuildFailed    bool              `json:"buildFailed"`
+	Participation  *ParticipationRef `json:"participation"`
+
+	// Only set by newer Artemis versions
+	ParticipationIDField int `json:"participationId"`
+	ExerciseID           int `json:"exerciseId"`
+}
+
+// The participation the submission belongs to, zero if unknown
+func (s *Submission) ParticipationID() int {
+	if s.Participation != nil && s.Participation.ID != 0 {
+		return s.Participation.ID
+	}
+
+	return s.ParticipationIDField
+}
+
+// A build result as sent to /user/topic/newResults
+type Result struct {
+	ID             int        `json:"id"`
+	CompletionDate *time.Time `json:"completionDate"`
+	Successful     bool       `json:"successful"`
+	// Percentage of points, missing for some failed builds
+	Score          float64           `json:"score"`
+	Rated          bool              `json:"rated"`
+	AssessmentType string            `json:"assessmentType"`
+	Submission     *Submission       `json:"submission"`
+	Participation  *ParticipationRef `json:"participation"`
+
+	// Feedback summary
+	TestCaseCount       int `json:"testCaseCount"`
+	PassedTestCaseCount int `json:"passedTestCaseCount"`
+	CodeIssueCount      int `json:"codeIssueCount"`
+}
+
+// The participation the result belongs to, zero if unknown
+func (r *Result) ParticipationID() int {
+	if r.Participation != nil && r.Participation.ID != 0 {
+		return r.Participation.ID
+	}
+	if r.Submission != nil {
+		return r.Submission.ParticipationID()
+	}
+
+	return 0
+}
+
+// The commit the result was built from, empty if unknown
+func (r *Result) CommitHash() string {
+	if r.Submission == nil {
+		return ""
+	}
+
+	return r.Submission.CommitHash
+}
+
+// Whether the build of the result failed
+func (r *Result) BuildFailed() bool {
+	return r.Submission != nil && r.Submission.BuildFailed
+}
+
+// The score as a whole percentage
+func (r *Result) Percentage() int {
+	return int(r.Score)
+}
@@ -1,6 +1,12 @@
 package artemis
 
 import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/charmbracelet/log"
+
 	"github.com/coronon/artemisbot/internal/easygit"
 	"github.com/coronon/artemisbot/internal/git"
 )
@@ -8,42 +14,57 @@ import (
 type Task struct {
 	CourseID          string
 	TaskID            string
+	ParticipationID   int
 	CurrentPercentage int
 	DesiredPercentage int
 	GitConfig         *git.GitConfig
+	GitBackend        string
+	// Get a VCS access token for the participation if none is configured
+	FetchVCSToken bool
+	// How to pick the author of the commits
+	Author AuthorConfig
 
 	client         *ArtemisClient
 	repository     git.Repository
 	gitCredentials *git.GitCredentials
+
+	// Guards lastCommitHash, which is read while routing build events
+	mtx            sync.Mutex
+	lastCommitHash string
 }
 
 func NewRetriggerTask(
+	ctx context.Context,
 	client *ArtemisClient,
 	courseID, taskID string,
 	gitCredentials *git.GitCredentials,
 	desiredPercentage int,
+	gitBackend string,
+	fetchVCSToken bool,
+	author AuthorConfig,
 ) (*Task, error) {
+	// The participation token must not leak into the credentials of other tasks
+	credentials := *gitCredentials
+
 	task := &Task{
 		CourseID:          courseID,
 		TaskID:            taskID,
 		DesiredPercentage: desiredPercentage,
+		GitBackend:        gitBackend,
+		FetchVCSToken:     fetchVCSToken,
+		Author:            author,
 
 		client:         client,
-		gitCredentials: gitCredentials,
+		gitCredentials: &credentials,
 	}
 
 	// Resolve the task
-	if err := task.Resolve(); err != nil {
+	if err := task.Resolve(ctx); err != nil {
 		return nil, err
 	}
 
-	// Clone the repository
-	dir, err := task.client.NewTempDir(false)
-	if err != nil {
-		return nil, err
-	}
-
-	repo, err := easygit.NewRepository(task.GitConfig, task.gitCredentials, dir)
+	// Open the repository
+	repo, err := task.openRepository(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -52,26 +73,98 @@ func NewRetriggerTask(
 	return task, nil
 }
 
+// Open the participation repository using the configured git backend
+func (t *Task) openRepository(ctx context.Context) (git.Repository, error) {
+	backend := t.GitBackend
+	if t.gitCredentials.SSH != nil && backend == git.BackendNative {
+		// The native backend only speaks smart HTTP
+		log.Debug("Using the go-git backend for SSH")
+		backend = git.BackendGoGit
+	}
+
+	switch backend {
+	case git.BackendNative:
+		return git.NewNativeRepository(ctx, t.GitConfig, t.gitCredentials)
+	case git.BackendGoGit:
+		// Clone the repository
+		dir, err := t.client.NewTempDir(false)
+		if err != nil {
+			return nil, err
+		}
+
+		return easygit.NewRepository(ctx, t.GitConfig, t.gitCredentials, dir)
+	default:
+		return nil, fmt.Errorf("unknown git backend: %s", t.GitBackend)
+	}
+}
+
 // Cleanup the task
 func (t *Task) Cleanup() error {
 	return t.repository.Close()
 }
 
+// Recover the repository after a failed push
+//
+// The existing repository is synced with the remote first and only opened
+// again (which means a fresh clone for the go-git backend) if that fails.
+func (t *Task) Repair(ctx context.Context) error {
+	err := t.repository.Sync(ctx)
+	if err == nil {
+		return nil
+	}
+	log.Warnf("Could not sync the repository, opening it again: %s", err.Error())
+
+	repo, err := t.openRepository(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.repository.Close()
+	t.repository = repo
+
+	return nil
+}
+
 // Populate the task with the necessary information for working with the Artemis API
 //
 // Normally this should have already been done by the constructor.
-func (t *Task) Resolve() error {
-	details, err := t.client.GetExerciseDetails(t.TaskID)
+func (t *Task) Resolve(ctx context.Context) error {
+	details, err := t.client.GetExerciseDetails(ctx, t.TaskID)
+	if err != nil {
+		return err
+	}
+
+	t.ParticipationID = details.StudentParticipations[0].ID
+
+	// Commit author
+	var account *Account
+	if t.Author.needsAccount() {
+		if account, err = t.client.GetAccount(ctx); err != nil {
+			return fmt.Errorf("could not get the account for the commit author: %w", err)
+		}
+	}
+	name, email, err := t.Author.author(account)
 	if err != nil {
 		return err
 	}
+	log.Debugf("Committing as %s <%s>", name, email)
 
 	// Git config
 	t.GitConfig = &git.GitConfig{
 		URL:    details.StudentParticipations[0].RepositoryURI,
 		Branch: details.StudentParticipations[0].Branch,
-		Name:   details.StudentParticipations[0].ParticipantName,
-		Email:  details.StudentParticipations[0].ParticipantIdentifier + "@mytum.de",
+		Name:   name,
+		Email:  email,
+	}
+
+	// Use a VCS access token instead of the password for git
+	if t.FetchVCSToken && t.gitCredentials.Token == "" {
+		token, err := t.client.GetParticipationVCSAccessToken(ctx, details.StudentParticipations[0].ID)
+		if err != nil {
+			return fmt.Errorf("could not get a VCS access token: %w", err)
+		}
+		log.Debug("Using the VCS access token of the participation")
+		t.gitCredentials.Token = token.Token
 	}
 
 	// Current percentage
@@ -81,6 +174,56 @@ func (t *Task) Resolve() error {
 }
 
 // Retrigger the task to update the percentage and return the commit hash
-func (t *Task) Retrigger() (string, error) {
-	return t.repository.PushEmptyCommit()
+func (t *Task) Retrigger(ctx context.Context) (string, error) {
+	hash, err := t.repository.PushEmptyCommit(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.mtx.Lock()
+	t.lastCommitHash = hash
+	t.mtx.Unlock()
+
+	return hash, nil
+}
+
+// The commit pushed by the last retrigger, empty if there was none
+func (t *Task) LastCommitHash() string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.lastCommitHash
+}
+
+// Get the build log of a result of the task
+func (t *Task) BuildLogs(ctx context.Context, resultID int) ([]*BuildLogEntry, error) {
+	return t.client.GetBuildLogs(ctx, t.ParticipationID, resultID)
+}
+
+// Get the detailed feedback of a result of the task
+func (t *Task) Feedback(ctx context.Context, resultID int) (*ResultFeedback, error) {
+	return t.client.GetResultFeedback(ctx, t.ParticipationID, resultID)
+}
+
+// Whether a submission was built from the commit we pushed last
+func (t *Task) MatchesSubmission(submission *Submission) bool {
+	return t.matches(submission.ParticipationID(), submission.CommitHash)
+}
+
+// Whether a result belongs to the commit we pushed last
+func (t *Task) MatchesResult(result *Result) bool {
+	return t.matches(result.ParticipationID(), result.CommitHash())
+}
+
+// Unknown participations and commits are accepted, as older Artemis
+// versions do not always send them
+func (t *Task) matches(participationID int, commitHash string) bool {
+	if participationID != 0 && participationID != t.ParticipationID {
+		return false
+	}
+	lastCommitHash := t.LastCommitHash()
+	if commitHash != "" && lastCommitHash != "" && commitHash != lastCommitHash {
+		return false
+	}
+
+	return true
 }
@@ -0,0 +1,150 @@
+package artemis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/coronon/artemisbot/internal/util"
+)
+
+// Name of the token cache inside the working directory
+const tokenCacheFilename = "tokens.json"
+
+// JWTs of previous logins, stored in the working directory
+//
+// Tokens are keyed by Artemis instance and username, so one working
+// directory can hold the sessions of several accounts. The file is only
+// readable by the current user.
+type TokenCache struct {
+	mtx  sync.Mutex
+	path string
+}
+
+// Create a token cache inside workdir
+func NewTokenCache(workdir string) *TokenCache {
+	return &TokenCache{
+		path: filepath.Join(workdir, tokenCacheFilename),
+	}
+}
+
+// Build the cache key of a user on an Artemis instance
+func tokenCacheKey(httpURL, username string) string {
+	return fmt.Sprintf("%s@%s", username, httpURL)
+}
+
+// Get the raw JWT stored under key, empty if there is none
+func (c *TokenCache) Load(key string) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tokens, err := c.read()
+	if err != nil {
+		return "", err
+	}
+
+	return tokens[key], nil
+}
+
+// Store a raw JWT under key, replacing any previous one
+func (c *TokenCache) Store(key, token string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tokens, err := c.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = token
+
+	return c.write(tokens)
+}
+
+// Remove the JWT stored under key
+//
+// Returns false if there was no token to remove.
+func (c *TokenCache) Delete(key string) (bool, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tokens, err := c.read()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := tokens[key]; !ok {
+		return false, nil
+	}
+	delete(tokens, key)
+
+	return true, c.write(tokens)
+}
+
+func (c *TokenCache) read() (map[string]string, error) {
+	tokens := map[string]string{}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the token cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("could not parse the token cache: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Write all tokens to the cache file
+func (c *TokenCache) write(tokens map[string]string) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(c.path, data, 0600); err != nil {
+		return fmt.Errorf("could not write the token cache: %w", err)
+	}
+
+	return nil
+}
+
+// Strip what users commonly copy along with a JWT from the browser
+func normalizeToken(raw string) string {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "jwt=")
+	raw = strings.TrimPrefix(raw, "Bearer ")
+
+	return strings.TrimSuffix(raw, ";")
+}
+
+// The username (subject) a raw JWT was issued for
+func TokenUsername(raw string) (string, error) {
+	token, err := parseJWT(normalizeToken(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid Artemis token: %w", err)
+	}
+
+	return token.Claims.GetSubject()
+}
+
+// Parse a raw JWT without verifying its signature
+//
+// Only Artemis can verify the token, we merely need its expiry.
+func parseJWT(raw string) (*jwt.Token, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(raw, &jwt.RegisteredClaims{})
+	if err != nil {
+		return nil, err
+	}
+	token.Valid = true
+
+	return token, nil
+}
@@ -1,17 +1,91 @@
 package config
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The Artemis instance used when nothing else is configured
+const DefaultInstanceURL = "https://artemis.in.tum.de"
+
 type Config struct {
 	// The Artemis base URL to use for HTTP requests
 	ArtemisHttpURL string `json:"artemis_http_url"`
 	// The Artemis base URL to use for WebSocket requests
 	ArtemisWsURL string `json:"artemis_ws_url"`
+
+	// scheme://host of the Artemis web interface
+	origin string
 }
 
-var C *Config
+// Create a config for the Artemis instance hosted at instanceURL
+//
+// The instance URL is the address of the Artemis web interface, e.g.
+// https://artemis.in.tum.de. The HTTP and WebSocket base URLs are derived
+// from it.
+func NewConfig(instanceURL string) (*Config, error) {
+	instance, err := url.Parse(strings.TrimSuffix(instanceURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Artemis instance URL %q: %w", instanceURL, err)
+	}
+	if instance.Host == "" {
+		return nil, fmt.Errorf("invalid Artemis instance URL %q: missing host", instanceURL)
+	}
 
-func init() {
-	C = &Config{
-		ArtemisHttpURL: "https://artemis.in.tum.de/api",
-		ArtemisWsURL:   "wss://artemis.in.tum.de/websocket",
+	var wsScheme string
+	switch instance.Scheme {
+	case "https":
+		wsScheme = "wss"
+	case "http":
+		wsScheme = "ws"
+	default:
+		return nil, fmt.Errorf("invalid Artemis instance URL %q: unsupported scheme %q", instanceURL, instance.Scheme)
+	}
+
+	base := instance.Host + instance.Path
+
+	return &Config{
+		ArtemisHttpURL: fmt.Sprintf("%s://%s/api", instance.Scheme, base),
+		ArtemisWsURL:   fmt.Sprintf("%s://%s/websocket", wsScheme, base),
+		origin:         instance.Scheme + "://" + instance.Host,
+	}, nil
+}
+
+// Replace the derived base URLs with explicitly configured ones
+//
+// Empty values keep the derived URL.
+func (c *Config) Override(httpURL, wsURL string) {
+	if httpURL != "" {
+		c.ArtemisHttpURL = strings.TrimSuffix(httpURL, "/")
+	}
+	if wsURL != "" {
+		c.ArtemisWsURL = strings.TrimSuffix(wsURL, "/")
 	}
 }
+
+// The address of the Artemis web interface, used as the websocket Origin
+//
+// This does not depend on overridden base URLs, which may use any path.
+func (c *Config) Origin() string {
+	if c.origin != "" {
+		return c.origin
+	}
+
+	u, err := url.Parse(c.ArtemisHttpURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// The host name of the Artemis instance
+func (c *Config) Host() string {
+	u, err := url.Parse(c.ArtemisHttpURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
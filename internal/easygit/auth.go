@@ -0,0 +1,158 @@
+package easygit
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coronon/artemisbot/internal/git"
+)
+
+// Pick the remote URI and auth method for the configured transport
+func remoteAuth(config *git.GitConfig, credentials *git.GitCredentials) (string, transport.AuthMethod, error) {
+	if credentials.SSH == nil {
+		remote, err := git.RepositoryURL(config.URL, credentials)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return remote, &http.BasicAuth{
+			Username: credentials.Username,
+			Password: credentials.Secret(),
+		}, nil
+	}
+
+	remote, err := git.SSHURL(config.URL, credentials.SSH)
+	if err != nil {
+		return "", nil, err
+	}
+	auth, err := sshAuth(remote, credentials.SSH)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return remote, auth, nil
+}
+
+// Authenticate with the key file or the ssh-agent and verify host keys
+func sshAuth(remote string, config *git.SSHConfig) (transport.AuthMethod, error) {
+	user, hostWithPort := sshEndpoint(remote)
+
+	db, err := knownHostsDB(config.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth gitssh.AuthMethod
+	if config.KeyFile != "" {
+		keys, err := gitssh.NewPublicKeysFromFile(user, config.KeyFile, config.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the SSH key: %w", err)
+		}
+		keys.HostKeyCallback = db.HostKeyCallback()
+		auth = keys
+	} else {
+		agent, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("could not use the ssh-agent: %w", err)
+		}
+		agent.HostKeyCallback = db.HostKeyCallback()
+		auth = agent
+	}
+
+	return &knownHostsAuth{
+		AuthMethod:   auth,
+		db:           db,
+		hostWithPort: hostWithPort,
+	}, nil
+}
+
+// Verify host keys against our known_hosts files
+//
+// go-git negotiates the host key algorithms using the default known_hosts
+// files even if a custom callback is set, so they are configured here.
+type knownHostsAuth struct {
+	gitssh.AuthMethod
+
+	db           *knownhosts.HostKeyDB
+	hostWithPort string
+}
+
+func (a *knownHostsAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	config, err := a.AuthMethod.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.HostKeyAlgorithms = a.db.HostKeyAlgorithms(a.hostWithPort)
+	if len(config.HostKeyAlgorithms) == 0 {
+		return nil, fmt.Errorf("the host key of %s is not in known_hosts", a.hostWithPort)
+	}
+
+	return config, nil
+}
+
+// Load the known_hosts files, defaulting to those used by OpenSSH
+func knownHostsDB(files []string) (*knownhosts.HostKeyDB, error) {
+	if len(files) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+
+		existing := []string{}
+		for _, file := range files {
+			if _, err := os.Stat(file); err == nil {
+				existing = append(existing, file)
+			}
+		}
+		files = existing
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no known_hosts file found, add the host key of the Artemis instance to ~/.ssh/known_hosts")
+	}
+
+	db, err := knownhosts.NewDB(files...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load known hosts: %w", err)
+	}
+
+	return db, nil
+}
+
+// Get the user and host:port of an ssh:// or scp-like URI
+func sshEndpoint(remote string) (string, string) {
+	user := "git"
+	host := remote
+	port := "22"
+
+	if u, err := url.Parse(remote); err == nil && u.Scheme == "ssh" {
+		if u.User != nil && u.User.Username() != "" {
+			user = u.User.Username()
+		}
+		host = u.Hostname()
+		if u.Port() != "" {
+			port = u.Port()
+		}
+
+		return user, net.JoinHostPort(host, port)
+	}
+
+	// user@host:path
+	if at := strings.Index(host, "@"); at >= 0 {
+		user = host[:at]
+		host = host[at+1:]
+	}
+	host, _, _ = strings.Cut(host, ":")
+
+	return user, net.JoinHostPort(host, port)
+}
@@ -1,7 +1,9 @@
 package easygit
 
 import (
+	"context"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -9,25 +11,26 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
 
 	"github.com/coronon/artemisbot/internal/git"
 )
 
-func NewRepository(config *git.GitConfig, credentials *git.GitCredentials, path string) (git.Repository, error) {
-	auth := &http.BasicAuth{
-		Username: credentials.Username,
-		Password: credentials.Password,
+func NewRepository(ctx context.Context, config *git.GitConfig, credentials *git.GitCredentials, path string) (git.Repository, error) {
+	url, auth, err := remoteAuth(config, credentials)
+	if err != nil {
+		return nil, err
 	}
 
-	repo, err := gogit.PlainClone(path, false, &gogit.CloneOptions{
-		URL:           config.URL,
+	repo, err := gogit.PlainCloneContext(ctx, path, false, &gogit.CloneOptions{
+		URL:           url,
 		Auth:          auth,
 		ReferenceName: plumbing.ReferenceName(config.Branch),
 		SingleBranch:  true,
 		Progress:      nil,
 	})
 	if err != nil {
+		// Don't leave a partial clone behind
+		os.RemoveAll(path)
 		return nil, err
 	}
 
@@ -60,7 +63,7 @@ func (r *GoGitRepository) Close() error {
 	return os.RemoveAll(r.path)
 }
 
-func (r *GoGitRepository) PushEmptyCommit() (string, error) {
+func (r *GoGitRepository) PushEmptyCommit(ctx context.Context) (string, error) {
 	r.mux.Lock()
 	defer r.mux.Unlock()
 
@@ -86,7 +89,7 @@ func (r *GoGitRepository) PushEmptyCommit() (string, error) {
 	}
 
 	// Push commit
-	err = r.repo.Push(&gogit.PushOptions{
+	err = r.repo.PushContext(ctx, &gogit.PushOptions{
 		Auth:     r.auth,
 		Progress: nil,
 		Atomic:   true,
@@ -97,3 +100,34 @@ func (r *GoGitRepository) PushEmptyCommit() (string, error) {
 
 	return hash.String(), nil
 }
+
+func (r *GoGitRepository) Sync(ctx context.Context) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	err := r.repo.FetchContext(ctx, &gogit.FetchOptions{
+		Auth:     r.auth,
+		Progress: nil,
+		Force:    true,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	// Drop local commits that did not make it to the remote
+	branch := strings.TrimPrefix(git.BranchRef(r.config.Branch), "refs/heads/")
+	remoteRef, err := r.repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return err
+	}
+
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Reset(&gogit.ResetOptions{
+		Commit: remoteRef.Hash(),
+		Mode:   gogit.HardReset,
+	})
+}
@@ -0,0 +1,137 @@
+package flaky
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coronon/artemisbot/internal/util"
+)
+
+// Name of the attempt history inside the working directory
+const historyFilename = "attempts.json"
+
+// The outcome of a single test in one attempt
+type TestOutcome struct {
+	Passed  bool    `json:"passed"`
+	Credits float64 `json:"credits"`
+}
+
+// The test outcomes of one retrigger attempt
+type Attempt struct {
+	ResultID   int                    `json:"resultId"`
+	CommitHash string                 `json:"commitHash"`
+	Time       time.Time              `json:"time"`
+	Score      float64                `json:"score"`
+	Tests      map[string]TestOutcome `json:"tests"`
+}
+
+// Test outcomes of previous attempts, stored in the working directory
+//
+// Attempts are keyed by Artemis instance, user and exercise, so the history
+// survives restarts and can be analyzed while a run is still going.
+type History struct {
+	mtx  sync.Mutex
+	path string
+}
+
+// Create an attempt history inside workdir
+func NewHistory(workdir string) *History {
+	return &History{
+		path: filepath.Join(workdir, historyFilename),
+	}
+}
+
+// Build the history key of an exercise of a user on an Artemis instance
+func Key(httpURL, username, exerciseID string) string {
+	return fmt.Sprintf("%s@%s/exercises/%s", username, httpURL, exerciseID)
+}
+
+// Get the attempts stored under key, oldest first
+func (h *History) Load(key string) ([]*Attempt, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	attempts, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts[key], nil
+}
+
+// Add an attempt under key
+//
+// Attempts for a result that is already stored are ignored.
+func (h *History) Append(key string, attempt *Attempt) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	attempts, err := h.read()
+	if err != nil {
+		return err
+	}
+	for _, other := range attempts[key] {
+		if other.ResultID == attempt.ResultID {
+			return nil
+		}
+	}
+	attempts[key] = append(attempts[key], attempt)
+
+	return h.write(attempts)
+}
+
+// Remove all attempts stored under key
+//
+// Returns false if there were none.
+func (h *History) Delete(key string) (bool, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	attempts, err := h.read()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := attempts[key]; !ok {
+		return false, nil
+	}
+	delete(attempts, key)
+
+	return true, h.write(attempts)
+}
+
+func (h *History) read() (map[string][]*Attempt, error) {
+	attempts := map[string][]*Attempt{}
+
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return attempts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the attempt history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &attempts); err != nil {
+		return nil, fmt.Errorf("could not parse the attempt history: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// Write all attempts to the history file
+func (h *History) write(attempts map[string][]*Attempt) error {
+	data, err := json.MarshalIndent(attempts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(h.path, data, 0600); err != nil {
+		return fmt.Errorf("could not write the attempt history: %w", err)
+	}
+
+	return nil
+}
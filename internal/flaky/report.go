@@ -0,0 +1,174 @@
+package flaky
+
+import (
+	"math"
+	"sort"
+)
+
+// Confidence used for the pessimistic estimate of attempts
+const confidence = 0.9
+
+// Pass statistics of one test across attempts
+type TestStats struct {
+	Name     string  `json:"name"`
+	Runs     int     `json:"runs"`
+	Passes   int     `json:"passes"`
+	PassRate float64 `json:"passRate"`
+	// Credits the test is worth when it passes
+	Weight float64 `json:"weight"`
+}
+
+// Whether the test both passed and failed
+func (s *TestStats) Flaky() bool {
+	return s.Passes > 0 && s.Passes < s.Runs
+}
+
+// Whether the test failed in every attempt
+func (s *TestStats) AlwaysFails() bool {
+	return s.Passes == 0
+}
+
+// What the attempts of an exercise say about its tests
+type Report struct {
+	Attempts          int `json:"attempts"`
+	DesiredPercentage int `json:"desiredPercentage"`
+	// Sorted by pass rate, least reliable first
+	Tests []*TestStats `json:"tests"`
+	// Tests that never passed
+	DeterministicFailures []string `json:"deterministicFailures"`
+
+	// Whether the desired percentage can be reached by retrying alone
+	Reachable bool `json:"reachable"`
+	// Estimated probability that a single attempt reaches the desired
+	// percentage
+	SuccessProbability float64 `json:"successProbability"`
+	// Expected number of further attempts, zero if unreachable
+	ExpectedAttempts float64 `json:"expectedAttempts"`
+	// Further attempts that reach the desired percentage with 90%
+	// confidence, zero if unreachable
+	ConfidentAttempts int `json:"confidentAttempts"`
+}
+
+// Analyze the attempts of an exercise
+//
+// Every test is assumed to pass independently with its observed pass rate
+// and to be worth the credits it got when passing. Tests that never passed
+// are weighted with the average credits, and if Artemis hides the credits
+// all tests are weighted equally. Penalties and bonus points are not taken
+// into account.
+func Analyze(attempts []*Attempt, desiredPercentage int) *Report {
+	report := &Report{
+		Attempts:              len(attempts),
+		DesiredPercentage:     desiredPercentage,
+		Tests:                 []*TestStats{},
+		DeterministicFailures: []string{},
+	}
+	if len(attempts) == 0 {
+		return report
+	}
+
+	// Pass rates and weights
+	tests := map[string]*TestStats{}
+	for _, attempt := range attempts {
+		for name, outcome := range attempt.Tests {
+			stats, ok := tests[name]
+			if !ok {
+				stats = &TestStats{Name: name}
+				tests[name] = stats
+			}
+
+			stats.Runs++
+			if outcome.Passed {
+				stats.Passes++
+				stats.Weight = max(stats.Weight, outcome.Credits)
+			}
+		}
+	}
+
+	var total float64
+	var weighted int
+	for _, stats := range tests {
+		stats.PassRate = float64(stats.Passes) / float64(stats.Runs)
+		if stats.Weight > 0 {
+			total += stats.Weight
+			weighted++
+		}
+		report.Tests = append(report.Tests, stats)
+	}
+	if total > 0 {
+		// Tests that never passed are assumed to be worth the average
+		average := total / float64(weighted)
+		for _, stats := range report.Tests {
+			if stats.AlwaysFails() {
+				stats.Weight = average
+				total += average
+			}
+		}
+	} else {
+		for _, stats := range report.Tests {
+			stats.Weight = 1
+		}
+		total = float64(len(report.Tests))
+	}
+
+	sort.Slice(report.Tests, func(i, j int) bool {
+		if report.Tests[i].PassRate != report.Tests[j].PassRate {
+			return report.Tests[i].PassRate < report.Tests[j].PassRate
+		}
+		return report.Tests[i].Name < report.Tests[j].Name
+	})
+	for _, stats := range report.Tests {
+		if stats.AlwaysFails() {
+			report.DeterministicFailures = append(report.DeterministicFailures, stats.Name)
+		}
+	}
+
+	// Attempts needed
+	if total == 0 {
+		return report
+	}
+	threshold := float64(desiredPercentage) / 100 * total
+	report.SuccessProbability = successProbability(report.Tests, threshold)
+	report.Reachable = report.SuccessProbability > 0
+	switch {
+	case report.SuccessProbability >= 1:
+		report.ExpectedAttempts = 1
+		report.ConfidentAttempts = 1
+	case report.Reachable:
+		report.ExpectedAttempts = 1 / report.SuccessProbability
+		report.ConfidentAttempts = int(math.Ceil(math.Log(1-confidence) / math.Log(1-report.SuccessProbability)))
+	}
+
+	return report
+}
+
+// The probability that the weights of the passing tests add up to at least
+// threshold
+func successProbability(tests []*TestStats, threshold float64) float64 {
+	// Distribution of the sum of weights, keyed in thousandths to avoid
+	// floating point keys
+	distribution := map[int64]float64{0: 1}
+	for _, stats := range tests {
+		weight := int64(math.Round(stats.Weight * 1000))
+		next := make(map[int64]float64, len(distribution)*2)
+		for sum, probability := range distribution {
+			if stats.PassRate > 0 {
+				next[sum+weight] += probability * stats.PassRate
+			}
+			if stats.PassRate < 1 {
+				next[sum] += probability * (1 - stats.PassRate)
+			}
+		}
+		distribution = next
+	}
+
+	needed := int64(math.Round(threshold * 1000))
+	var probability float64
+	for sum, p := range distribution {
+		if sum >= needed {
+			probability += p
+		}
+	}
+
+	return min(probability, 1)
+}
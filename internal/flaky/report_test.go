@@ -0,0 +1,199 @@
+package flaky
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Build attempts from test outcomes, each worth one credit
+func attempts(outcomes ...map[string]bool) []*Attempt {
+	result := []*Attempt{}
+	for i, tests := range outcomes {
+		attempt := &Attempt{ResultID: i + 1, Tests: map[string]TestOutcome{}}
+		for name, passed := range tests {
+			outcome := TestOutcome{Passed: passed}
+			if passed {
+				outcome.Credits = 1
+			}
+			attempt.Tests[name] = outcome
+		}
+		result = append(result, attempt)
+	}
+
+	return result
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []*Attempt
+		desired  int
+
+		passRates   map[string]float64
+		failures    []string
+		reachable   bool
+		probability float64
+		expected    float64
+		confident   int
+	}{
+		{
+			name:      "empty history",
+			attempts:  nil,
+			desired:   100,
+			passRates: map[string]float64{},
+			failures:  []string{},
+		},
+		{
+			name:        "always passes",
+			attempts:    attempts(map[string]bool{"a": true}, map[string]bool{"a": true}),
+			desired:     100,
+			passRates:   map[string]float64{"a": 1},
+			failures:    []string{},
+			reachable:   true,
+			probability: 1,
+			expected:    1,
+			confident:   1,
+		},
+		{
+			name:      "always fails",
+			attempts:  attempts(map[string]bool{"a": false}, map[string]bool{"a": false}),
+			desired:   100,
+			passRates: map[string]float64{"a": 0},
+			failures:  []string{"a"},
+		},
+		{
+			name:        "single run",
+			attempts:    attempts(map[string]bool{"a": true, "b": false}),
+			desired:     50,
+			passRates:   map[string]float64{"a": 1, "b": 0},
+			failures:    []string{"b"},
+			reachable:   true,
+			probability: 1,
+			expected:    1,
+			confident:   1,
+		},
+		{
+			name: "mixed history",
+			attempts: attempts(
+				map[string]bool{"stable": true, "flaky": true, "broken": false},
+				map[string]bool{"stable": true, "flaky": false, "broken": false},
+			),
+			desired:   60,
+			passRates: map[string]float64{"stable": 1, "flaky": 0.5, "broken": 0},
+			failures:  []string{"broken"},
+			// stable and flaky are needed for 2 of 3 credits
+			reachable:   true,
+			probability: 0.5,
+			expected:    2,
+			confident:   4,
+		},
+		{
+			name: "mixed history out of reach",
+			attempts: attempts(
+				map[string]bool{"stable": true, "flaky": true, "broken": false},
+				map[string]bool{"stable": true, "flaky": false, "broken": false},
+			),
+			desired:   100,
+			passRates: map[string]float64{"stable": 1, "flaky": 0.5, "broken": 0},
+			failures:  []string{"broken"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Analyze(tt.attempts, tt.desired)
+
+			if report.Attempts != len(tt.attempts) || report.DesiredPercentage != tt.desired {
+				t.Errorf("Attempts, DesiredPercentage = %d, %d, want %d, %d", report.Attempts, report.DesiredPercentage, len(tt.attempts), tt.desired)
+			}
+
+			passRates := map[string]float64{}
+			for _, stats := range report.Tests {
+				passRates[stats.Name] = stats.PassRate
+			}
+			if !reflect.DeepEqual(passRates, tt.passRates) {
+				t.Errorf("pass rates = %v, want %v", passRates, tt.passRates)
+			}
+			if !reflect.DeepEqual(report.DeterministicFailures, tt.failures) {
+				t.Errorf("DeterministicFailures = %v, want %v", report.DeterministicFailures, tt.failures)
+			}
+
+			if report.Reachable != tt.reachable {
+				t.Errorf("Reachable = %v, want %v", report.Reachable, tt.reachable)
+			}
+			if math.Abs(report.SuccessProbability-tt.probability) > 1e-9 {
+				t.Errorf("SuccessProbability = %v, want %v", report.SuccessProbability, tt.probability)
+			}
+			if math.Abs(report.ExpectedAttempts-tt.expected) > 1e-9 {
+				t.Errorf("ExpectedAttempts = %v, want %v", report.ExpectedAttempts, tt.expected)
+			}
+			if report.ConfidentAttempts != tt.confident {
+				t.Errorf("ConfidentAttempts = %d, want %d", report.ConfidentAttempts, tt.confident)
+			}
+
+			// NaN and infinities cannot be encoded
+			if _, err := json.Marshal(report); err != nil {
+				t.Errorf("report cannot be encoded: %v", err)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSortsLeastReliableFirst(t *testing.T) {
+	report := Analyze(attempts(
+		map[string]bool{"b": true, "a": true, "c": false},
+		map[string]bool{"b": true, "a": false, "c": false},
+	), 100)
+
+	names := []string{}
+	for _, stats := range report.Tests {
+		names = append(names, stats.Name)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("tests = %v, want %v", names, want)
+	}
+}
+
+func TestAnalyzeWeights(t *testing.T) {
+	report := Analyze([]*Attempt{
+		{ResultID: 1, Tests: map[string]TestOutcome{
+			"heavy":  {Passed: true, Credits: 3},
+			"light":  {Passed: true, Credits: 1},
+			"broken": {Passed: false},
+		}},
+	}, 100)
+
+	weights := map[string]float64{}
+	for _, stats := range report.Tests {
+		weights[stats.Name] = stats.Weight
+	}
+	// Tests that never passed get the average of the others
+	if want := map[string]float64{"heavy": 3, "light": 1, "broken": 2}; !reflect.DeepEqual(weights, want) {
+		t.Fatalf("weights = %v, want %v", weights, want)
+	}
+}
+
+func TestSuccessProbability(t *testing.T) {
+	tests := []struct {
+		name      string
+		tests     []*TestStats
+		threshold float64
+		want      float64
+	}{
+		{"no tests", nil, 0, 1},
+		{"independent", []*TestStats{{PassRate: 0.5, Weight: 1}, {PassRate: 0.5, Weight: 1}}, 2, 0.25},
+		{"either suffices", []*TestStats{{PassRate: 0.5, Weight: 1}, {PassRate: 0.5, Weight: 1}}, 1, 0.75},
+		{"out of reach", []*TestStats{{PassRate: 1, Weight: 1}}, 2, 0},
+		{"fractional weights", []*TestStats{{PassRate: 0.8, Weight: 0.1}, {PassRate: 1, Weight: 0.2}}, 0.3, 0.8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := successProbability(tt.tests, tt.threshold); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("successProbability() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/coronon/artemisbot/internal/util"
 )
 
-// Create a git commit object and return its compressed data and decompressed size
-func CreateCommitObject(tree, parent, author, committer, message string) ([]byte, int) {
+// Create a git commit object and return its compressed data, decompressed size
+// and object hash
+//
+// The compressed data does not contain the loose object header, so it can be
+// placed into a pack as is.
+func CreateCommitObject(tree, parent, author, committer, message string) ([]byte, int, string) {
 	now := time.Now()
 	_, offset := now.Zone()
 	var sign string
@@ -32,24 +37,31 @@ func CreateCommitObject(tree, parent, author, committer, message string) ([]byte
 	committer += timeSuffix
 
 	content := fmt.Sprintf("tree %s\nparent %s\nauthor %s\ncommitter %s\n\n%s", tree, parent, author, committer, message)
-	header := fmt.Sprintf("commit %d\x00", len(content))
-	obj := header + content
 
 	var buff bytes.Buffer
 	zw := zlib.NewWriter(&buff)
-	zw.Write([]byte(obj))
+	zw.Write([]byte(content))
 	zw.Close()
 
-	return buff.Bytes(), len(obj)
+	return buff.Bytes(), len(content), hashObject("commit", []byte(content))
+}
+
+// Calculate the object ID of a git object
+func hashObject(objType string, content []byte) string {
+	hasher := sha1.New()
+	fmt.Fprintf(hasher, "%s %d\x00", objType, len(content))
+	hasher.Write(content)
+
+	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-// Create a git packed object
+// Create a git pack containing a single commit object
 func CreatePackedObject(obj []byte, decompressedSize int) []byte {
 	pack := append([]byte("PACK"), []byte{0, 0, 0, 2, 0, 0, 0, 1}...)
 
 	// Meta data and variable length integers
 	metaBytes := encodeAsVariableLengthInt(decompressedSize)
-	metaBytes[0] |= 0x90
+	metaBytes[0] |= objCommit << 4
 	pack = append(pack, metaBytes...)
 
 	// Object data
@@ -87,7 +99,7 @@ func encodeAsVariableLengthInt(decompressedSize int) []byte {
 
 		goToNextByte := currentByteIndex > 6 || isFirst && currentByteIndex > 3
 		if goToNextByte {
-			if (decompressedSize >> i) > 0 {
+			if (decompressedSize >> (i + 1)) > 0 {
 				currentByte |= 0x80
 			}
 
@@ -0,0 +1,76 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"io"
+	"testing"
+)
+
+func TestEncodeAsVariableLengthInt(t *testing.T) {
+	tests := []struct {
+		size int
+		want []byte
+	}{
+		{1, []byte{0x01}},
+		{15, []byte{0x0f}},
+		{16, []byte{0x80, 0x01}},
+		{2047, []byte{0x8f, 0x7f}},
+		{2048, []byte{0x80, 0x80, 0x01}},
+		{262143, []byte{0x8f, 0xff, 0x7f}},
+		{262144, []byte{0x80, 0x80, 0x80, 0x01}},
+	}
+
+	for _, tt := range tests {
+		if got := encodeAsVariableLengthInt(tt.size); !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeAsVariableLengthInt(%d) = %x, want %x", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePackedObject(t *testing.T) {
+	tree := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	parent := "0123456789012345678901234567890123456789"
+	obj, size, hash := CreateCommitObject(tree, parent, "A <a@example.com>", "A <a@example.com>", "message\n")
+	if len(hash) != 40 {
+		t.Fatalf("CreateCommitObject() hash = %q, want 40 hex digits", hash)
+	}
+
+	pack := CreatePackedObject(obj, size)
+
+	header := []byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, 1}
+	if !bytes.HasPrefix(pack, header) {
+		t.Fatalf("pack header = %x, want %x", pack[:len(header)], header)
+	}
+
+	// Object header: commit type and the size
+	meta := encodeAsVariableLengthInt(size)
+	meta[0] |= objCommit << 4
+	if got := pack[len(header) : len(header)+len(meta)]; !bytes.Equal(got, meta) {
+		t.Fatalf("object header = %x, want %x", got, meta)
+	}
+	if (meta[0]>>4)&0x7 != objCommit {
+		t.Fatalf("object type = %d, want %d", (meta[0]>>4)&0x7, objCommit)
+	}
+
+	// The object data inflates to the commit
+	data := pack[len(header)+len(meta) : len(pack)-sha1.Size]
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("object data is not zlib compressed: %v", err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("could not inflate the object: %v", err)
+	}
+	if len(content) != size || hashObject("commit", content) != hash {
+		t.Fatalf("object = %q, want %d bytes hashing to %s", content, size, hash)
+	}
+
+	// Trailer
+	sum := sha1.Sum(pack[:len(pack)-sha1.Size])
+	if !bytes.Equal(pack[len(pack)-sha1.Size:], sum[:]) {
+		t.Fatalf("pack trailer does not match its checksum")
+	}
+}
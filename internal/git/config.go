@@ -1,5 +1,10 @@
 package git
 
+import (
+	"fmt"
+	"net/url"
+)
+
 type GitConfig struct {
 	URL    string
 	Branch string
@@ -10,4 +15,48 @@ type GitConfig struct {
 type GitCredentials struct {
 	Username string
 	Password string
+	// A VCS access token, used instead of the password if set
+	Token string
+	// Use SSH instead of HTTPS, the password and token are ignored then
+	SSH *SSHConfig
+}
+
+// The secret used to authenticate, preferring the VCS access token
+func (c *GitCredentials) Secret() string {
+	if c.Token != "" {
+		return c.Token
+	}
+
+	return c.Password
+}
+
+// Embed a VCS access token in the repository URI
+//
+// Artemis expects token authentication as https://<user>:<token>@host/...,
+// so the URI is returned unchanged when no token is set.
+func RepositoryURL(rawURL string, credentials *GitCredentials) (string, error) {
+	if credentials == nil || credentials.Token == "" {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URI: %w", err)
+	}
+
+	username := credentials.Username
+	if username == "" && u.User != nil {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, credentials.Token)
+
+	return u.String(), nil
 }
+
+// Supported implementations of Repository
+const (
+	// Talk smart HTTP directly without cloning
+	BackendNative = "native"
+	// Clone the repository with go-git
+	BackendGoGit = "go-git"
+)
@@ -0,0 +1,207 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Packed object types
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+// Fetch a single commit from the remote and return the hash of its tree
+//
+// Only the commit itself is requested: the history is cut with a shallow
+// fetch and, if the server supports it, trees and blobs are filtered out so
+// large repositories are not downloaded.
+func FetchCommitTree(ctx context.Context, url string, credentials *GitCredentials, commit string) (string, error) {
+	adv, err := DiscoverRefs(ctx, url, "git-upload-pack", credentials)
+	if err != nil {
+		return "", err
+	}
+
+	// Build request
+	caps := []string{"agent=artemisbot"}
+	for _, capability := range []string{"no-progress", "shallow", "filter"} {
+		if adv.HasCapability(capability) {
+			caps = append(caps, capability)
+		}
+	}
+
+	var body bytes.Buffer
+	body.WriteString(encodePktLine(fmt.Sprintf("want %s %s\n", commit, strings.Join(caps, " "))))
+	if adv.HasCapability("shallow") {
+		body.WriteString(encodePktLine("deepen 1\n"))
+	}
+	if adv.HasCapability("filter") {
+		body.WriteString(encodePktLine("filter tree:0\n"))
+	}
+	body.WriteString(flushPkt)
+	body.WriteString(encodePktLine("done\n"))
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		strings.TrimSuffix(url, "/")+"/git-upload-pack",
+		&body,
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	setAuth(req, credentials)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch commit: %s", resp.Status)
+	}
+
+	// Skip shallow info and acknowledgements until the pack starts
+	pkt := newPktLineReader(resp.Body)
+	for {
+		payload, isFlush, err := pkt.Next()
+		if err != nil {
+			return "", err
+		}
+		if isFlush {
+			continue
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		if strings.HasPrefix(line, "ERR ") {
+			return "", fmt.Errorf("remote error: %s", strings.TrimPrefix(line, "ERR "))
+		}
+		if line == "NAK" || strings.HasPrefix(line, "ACK ") {
+			break
+		}
+	}
+
+	content, err := findPackedCommit(pkt.Raw(), commit)
+	if err != nil {
+		return "", err
+	}
+
+	return parseCommitTree(content)
+}
+
+// Read a pack stream until the given commit is found and return its content
+func findPackedCommit(r *bufio.Reader, commit string) ([]byte, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("invalid pack signature")
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+
+	for i := uint32(0); i < count; i++ {
+		objType, _, err := readPackedObjectHeader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip delta bases, we only need the object data
+		switch objType {
+		case objOfsDelta:
+			if _, err := readOffsetEncoding(r); err != nil {
+				return nil, err
+			}
+		case objRefDelta:
+			if _, err := io.CopyN(io.Discard, r, 20); err != nil {
+				return nil, err
+			}
+		}
+
+		// bufio.Reader implements io.ByteReader, so zlib will not read past
+		// the end of the compressed object
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(zr)
+		zr.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if objType == objCommit && hashObject("commit", content) == commit {
+			return content, nil
+		}
+	}
+
+	return nil, fmt.Errorf("commit %s not found in pack", commit)
+}
+
+// Read the type and decompressed size of a packed object
+func readPackedObjectHeader(r io.ByteReader) (int, int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	objType := int(b>>4) & 0x07
+	size := int(b & 0x0f)
+	shift := 4
+	for b&0x80 != 0 {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		size |= int(b&0x7f) << shift
+		shift += 7
+	}
+
+	return objType, size, nil
+}
+
+// Read the negative base offset of an OFS_DELTA object
+func readOffsetEncoding(r io.ByteReader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int(b & 0x7f)
+	for b&0x80 != 0 {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		offset = ((offset + 1) << 7) | int(b&0x7f)
+	}
+
+	return offset, nil
+}
+
+// Extract the tree hash from the content of a commit object
+func parseCommitTree(content []byte) (string, error) {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	tree, ok := bytes.CutPrefix(line, []byte("tree "))
+	if !ok || len(tree) != 40 {
+		return "", fmt.Errorf("commit has no tree")
+	}
+
+	return string(tree), nil
+}
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A request or reply of git's credential helper protocol
+//
+// See git-credential(1). Attributes are written as key=value lines and
+// terminated by an empty line or the end of the input.
+type CredentialDescription struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Read a credential description from a git credential helper request
+//
+// Unknown attributes are ignored.
+func ReadCredentialDescription(r io.Reader) (*CredentialDescription, error) {
+	desc := &CredentialDescription{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid credential attribute %q", line)
+		}
+
+		switch key {
+		case "protocol":
+			desc.Protocol = value
+		case "host":
+			desc.Host = value
+		case "path":
+			desc.Path = value
+		case "username":
+			desc.Username = value
+		case "password":
+			desc.Password = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return desc, nil
+}
+
+// Write the credentials as a git credential helper reply
+func (d *CredentialDescription) Write(w io.Writer) error {
+	for _, attr := range []struct{ key, value string }{
+		{"protocol", d.Protocol},
+		{"host", d.Host},
+		{"username", d.Username},
+		{"password", d.Password},
+	} {
+		if attr.value == "" {
+			continue
+		}
+		if strings.ContainsAny(attr.value, "\n\x00") {
+			return fmt.Errorf("invalid credential attribute %s", attr.key)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", attr.key, attr.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Create a repository that talks to the remote directly over smart HTTP
+//
+// Nothing is cloned: every push discovers the branch tip, fetches only the
+// tip commit (to learn its tree) and sends a pack with a single new commit.
+func NewNativeRepository(ctx context.Context, config *GitConfig, credentials *GitCredentials) (Repository, error) {
+	if credentials != nil && credentials.SSH != nil {
+		return nil, fmt.Errorf("the native backend does not support SSH")
+	}
+
+	url, err := RepositoryURL(config.URL, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &NativeRepository{
+		mux:         sync.Mutex{},
+		config:      config,
+		credentials: credentials,
+		url:         url,
+		ref:         BranchRef(config.Branch),
+
+		isClosed: false,
+	}
+
+	// Make sure we can access the repository before the first push
+	if _, err := repo.resolveTip(ctx); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+type NativeRepository struct {
+	mux         sync.Mutex
+	config      *GitConfig
+	credentials *GitCredentials
+	// The repository URI including the VCS access token, if any
+	url string
+	ref string
+
+	// The last commit we pushed and its tree, used to skip fetching the tip
+	lastCommit string
+	lastTree   string
+
+	isClosed bool
+}
+
+func (r *NativeRepository) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.isClosed = true
+
+	return nil
+}
+
+func (r *NativeRepository) PushEmptyCommit(ctx context.Context) (string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.isClosed {
+		return "", fmt.Errorf("repository is closed")
+	}
+
+	parent, err := r.resolveTip(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// An empty commit reuses the tree of its parent
+	tree := r.lastTree
+	if parent != r.lastCommit {
+		tree, err = FetchCommitTree(ctx, r.url, r.credentials, parent)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Build commit
+	sig := fmt.Sprintf("%s <%s>", r.config.Name, r.config.Email)
+	obj, size, hash := CreateCommitObject(tree, parent, sig, sig, "retrigger\n")
+	pack := CreatePackedObject(obj, size)
+
+	// Push commit
+	if err := PushCommit(ctx, r.url, r.credentials, r.ref, parent, hash, pack); err != nil {
+		return "", err
+	}
+
+	r.lastCommit = hash
+	r.lastTree = tree
+
+	return hash, nil
+}
+
+func (r *NativeRepository) Sync(ctx context.Context) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	// Forget the cached tree so the next push fetches the tip again
+	r.lastCommit = ""
+	r.lastTree = ""
+
+	_, err := r.resolveTip(ctx)
+	return err
+}
+
+// Get the current commit of the configured branch on the remote
+func (r *NativeRepository) resolveTip(ctx context.Context) (string, error) {
+	adv, err := DiscoverRefs(ctx, r.url, "git-receive-pack", r.credentials)
+	if err != nil {
+		return "", err
+	}
+
+	tip, ok := adv.Refs[r.ref]
+	if !ok || tip == zeroHash {
+		return "", fmt.Errorf("branch %s not found on remote", r.ref)
+	}
+
+	return tip, nil
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A flush packet which terminates a section of pkt-lines
+const flushPkt = "0000"
+
+// The longest pkt-line git accepts, including the length prefix
+const maxPktLineLength = 65520
+
+// Encode a payload as a git pkt-line
+func encodePktLine(payload string) string {
+	return fmt.Sprintf("%04x%s", len(payload)+4, payload)
+}
+
+type pktLineReader struct {
+	r *bufio.Reader
+}
+
+func newPktLineReader(r io.Reader) *pktLineReader {
+	return &pktLineReader{r: bufio.NewReader(r)}
+}
+
+// Read the next pkt-line and return its payload
+//
+// A flush packet is reported with isFlush set and an empty payload.
+func (p *pktLineReader) Next() (payload []byte, isFlush bool, err error) {
+	var lengthBytes [4]byte
+	if _, err := io.ReadFull(p.r, lengthBytes[:]); err != nil {
+		return nil, false, err
+	}
+
+	length, err := strconv.ParseUint(string(lengthBytes[:]), 16, 16)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pkt-line length %q", lengthBytes)
+	}
+
+	if length == 0 {
+		return nil, true, nil
+	}
+	if length < 4 || length > maxPktLineLength {
+		return nil, false, fmt.Errorf("invalid pkt-line length %d", length)
+	}
+
+	payload = make([]byte, length-4)
+	if _, err := io.ReadFull(p.r, payload); err != nil {
+		return nil, false, err
+	}
+
+	return payload, false, nil
+}
+
+// Access the underlying reader once the pkt-line section is over
+//
+// Git switches from pkt-lines to raw pack data in some responses.
+func (p *pktLineReader) Raw() *bufio.Reader {
+	return p.r
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodePktLine(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"", "0004"},
+		{"a\n", "0006a\n"},
+		{"done\n", "0009done\n"},
+		{strings.Repeat("x", maxPktLineLength-4), "fff0" + strings.Repeat("x", maxPktLineLength-4)},
+	}
+
+	for _, tt := range tests {
+		if got := encodePktLine(tt.payload); got != tt.want {
+			t.Errorf("encodePktLine(%.10q) = %.10q, want %.10q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestPktLineReader(t *testing.T) {
+	longest := strings.Repeat("x", maxPktLineLength-4)
+	pkt := newPktLineReader(strings.NewReader(
+		encodePktLine("first\n") + flushPkt + encodePktLine("") + encodePktLine(longest) + "PACK",
+	))
+
+	want := []struct {
+		payload string
+		isFlush bool
+	}{
+		{"first\n", false},
+		{"", true},
+		{"", false},
+		{longest, false},
+	}
+	for i, w := range want {
+		payload, isFlush, err := pkt.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+		if string(payload) != w.payload || isFlush != w.isFlush {
+			t.Fatalf("Next() #%d = %.10q, %v, want %.10q, %v", i, payload, isFlush, w.payload, w.isFlush)
+		}
+	}
+
+	rest := make([]byte, 4)
+	if _, err := pkt.Raw().Read(rest); err != nil || string(rest) != "PACK" {
+		t.Fatalf("Raw() = %q, %v, want the remaining data", rest, err)
+	}
+}
+
+func TestPktLineReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"truncated length", "00"},
+		{"not hex", "00zz"},
+		{"shorter than its prefix", "0003"},
+		{"too long", "fff1"},
+		{"truncated payload", "000aabc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := newPktLineReader(strings.NewReader(tt.data)).Next(); err == nil {
+				t.Fatalf("Next() succeeded, want an error")
+			}
+		})
+	}
+}
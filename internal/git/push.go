@@ -1,5 +1,89 @@
 package git
 
-func PushCommit(url, username, password string, pack []byte) error {
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Update a ref on the remote using the smart HTTP protocol
+//
+// The pack must contain every object the remote needs to accept newHash.
+// The remote's report-status reply is parsed and any rejection is returned
+// as an error.
+func PushCommit(ctx context.Context, url string, credentials *GitCredentials, ref, oldHash, newHash string, pack []byte) error {
+	var body bytes.Buffer
+	body.WriteString(encodePktLine(fmt.Sprintf(
+		"%s %s %s\x00report-status agent=artemisbot\n",
+		oldHash,
+		newHash,
+		ref,
+	)))
+	body.WriteString(flushPkt)
+	body.Write(pack)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		strings.TrimSuffix(url, "/")+"/git-receive-pack",
+		&body,
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-git-receive-pack-request")
+	req.Header.Set("Accept", "application/x-git-receive-pack-result")
+	setAuth(req, credentials)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to push commit: %s", resp.Status)
+	}
+
+	return parseReportStatus(newPktLineReader(resp.Body), ref)
+}
+
+// Parse a report-status reply and check that the ref was updated
+func parseReportStatus(pkt *pktLineReader, ref string) error {
+	payload, _, err := pkt.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read report-status: %w", err)
+	}
+
+	unpack := strings.TrimSuffix(string(payload), "\n")
+	if unpack != "unpack ok" {
+		return fmt.Errorf("remote failed to unpack: %s", strings.TrimPrefix(unpack, "unpack "))
+	}
+
+	updated := false
+	for {
+		payload, isFlush, err := pkt.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read report-status: %w", err)
+		}
+		if isFlush {
+			break
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		switch {
+		case line == "ok "+ref:
+			updated = true
+		case strings.HasPrefix(line, "ng "+ref+" "):
+			return fmt.Errorf("remote rejected %s: %s", ref, strings.TrimPrefix(line, "ng "+ref+" "))
+		}
+	}
+
+	if !updated {
+		return fmt.Errorf("remote did not report the status of %s", ref)
+	}
+
 	return nil
 }
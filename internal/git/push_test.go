@@ -0,0 +1,143 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReportStatus(t *testing.T) {
+	const ref = "refs/heads/main"
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "ok",
+			data: encodePktLine("unpack ok\n") + encodePktLine("ok "+ref+"\n") + flushPkt,
+		},
+		{
+			name: "ok among other refs",
+			data: encodePktLine("unpack ok\n") + encodePktLine("ok refs/heads/other\n") + encodePktLine("ok "+ref) + flushPkt,
+		},
+		{
+			name:    "rejected",
+			data:    encodePktLine("unpack ok\n") + encodePktLine("ng "+ref+" non-fast-forward\n") + flushPkt,
+			wantErr: "remote rejected refs/heads/main: non-fast-forward",
+		},
+		{
+			name:    "unpack failed",
+			data:    encodePktLine("unpack index-pack abnormal exit\n") + flushPkt,
+			wantErr: "remote failed to unpack: index-pack abnormal exit",
+		},
+		{
+			name:    "other ref only",
+			data:    encodePktLine("unpack ok\n") + encodePktLine("ok refs/heads/other\n") + flushPkt,
+			wantErr: "did not report the status of refs/heads/main",
+		},
+		{
+			name:    "truncated",
+			data:    encodePktLine("unpack ok\n"),
+			wantErr: "failed to read report-status",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseReportStatus(newPktLineReader(strings.NewReader(tt.data)), ref)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseReportStatus() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseReportStatus() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A fake git-receive-pack that checks the request and replies with status
+func fakeReceivePack(t *testing.T, oldHash, newHash, ref string, pack []byte, status string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repo.git/git-receive-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-git-receive-pack-request" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		pkt := newPktLineReader(r.Body)
+		command, _, err := pkt.Next()
+		if err != nil {
+			t.Errorf("could not read the command: %v", err)
+		}
+		line, caps, _ := strings.Cut(strings.TrimSuffix(string(command), "\n"), "\x00")
+		if want := oldHash + " " + newHash + " " + ref; line != want {
+			t.Errorf("command = %q, want %q", line, want)
+		}
+		if !strings.Contains(caps, "report-status") {
+			t.Errorf("capabilities = %q, want report-status", caps)
+		}
+		if _, isFlush, err := pkt.Next(); err != nil || !isFlush {
+			t.Errorf("expected a flush after the command")
+		}
+		body, _ := io.ReadAll(pkt.Raw())
+		if !bytes.Equal(body, pack) {
+			t.Errorf("pack = %x, want %x", body, pack)
+		}
+
+		w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+		w.Write([]byte(status))
+	}))
+}
+
+func TestPushCommit(t *testing.T) {
+	const ref = "refs/heads/main"
+	obj, size, newHash := CreateCommitObject(testHashB, testHashA, "A <a@example.com>", "A <a@example.com>", "retrigger\n")
+	pack := CreatePackedObject(obj, size)
+	credentials := &GitCredentials{Username: "user", Password: "password"}
+
+	tests := []struct {
+		name    string
+		status  string
+		wantErr bool
+	}{
+		{"accepted", encodePktLine("unpack ok\n") + encodePktLine("ok "+ref+"\n") + flushPkt, false},
+		{"rejected", encodePktLine("unpack ok\n") + encodePktLine("ng "+ref+" stale info\n") + flushPkt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakeReceivePack(t, testHashA, newHash, ref, pack, tt.status)
+			defer server.Close()
+
+			err := PushCommit(context.Background(), server.URL+"/repo.git", credentials, ref, testHashA, newHash, pack)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PushCommit() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server := fakeReceivePack(t, testHashA, newHash, ref, pack, "")
+		defer server.Close()
+
+		wrong := &GitCredentials{Username: "user", Password: "wrong"}
+		if err := PushCommit(context.Background(), server.URL+"/repo.git", wrong, ref, testHashA, newHash, pack); err == nil {
+			t.Fatal("PushCommit() with wrong credentials succeeded, want an error")
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The all-zero object ID git uses for missing refs
+const zeroHash = "0000000000000000000000000000000000000000"
+
+type RefAdvertisement struct {
+	// Map of ref names (e.g. refs/heads/main) to their object IDs
+	Refs map[string]string
+	// Capabilities the server advertised on the first ref
+	Capabilities map[string]string
+}
+
+// Check if the server advertised a capability
+func (a *RefAdvertisement) HasCapability(name string) bool {
+	_, ok := a.Capabilities[name]
+	return ok
+}
+
+// Discover the refs of a remote repository using the smart HTTP protocol
+//
+// The service is either git-upload-pack or git-receive-pack.
+func DiscoverRefs(ctx context.Context, url, service string, credentials *GitCredentials) (*RefAdvertisement, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/info/refs?service=%s", strings.TrimSuffix(url, "/"), service),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	setAuth(req, credentials)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover refs: %s", resp.Status)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), fmt.Sprintf("application/x-%s-advertisement", service)) {
+		return nil, fmt.Errorf("server does not support the smart HTTP protocol")
+	}
+
+	return parseRefAdvertisement(resp.Body, service)
+}
+
+func parseRefAdvertisement(r io.Reader, service string) (*RefAdvertisement, error) {
+	adv := &RefAdvertisement{
+		Refs:         map[string]string{},
+		Capabilities: map[string]string{},
+	}
+	pkt := newPktLineReader(r)
+
+	// Service announcement
+	payload, _, err := pkt.Next()
+	if err != nil {
+		return nil, err
+	}
+	if string(bytes.TrimSuffix(payload, []byte("\n"))) != "# service="+service {
+		return nil, fmt.Errorf("unexpected service announcement %q", payload)
+	}
+	if _, isFlush, err := pkt.Next(); err != nil || !isFlush {
+		return nil, fmt.Errorf("expected flush after service announcement")
+	}
+
+	// Refs
+	isFirst := true
+	for {
+		payload, isFlush, err := pkt.Next()
+		if err != nil {
+			return nil, err
+		}
+		if isFlush {
+			break
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		if isFirst {
+			isFirst = false
+
+			var caps string
+			line, caps, _ = strings.Cut(line, "\x00")
+			for _, capability := range strings.Fields(caps) {
+				name, value, _ := strings.Cut(capability, "=")
+				adv.Capabilities[name] = value
+			}
+		}
+
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid ref line %q", line)
+		}
+
+		// Empty repositories advertise a placeholder to carry the capabilities
+		if name == "capabilities^{}" {
+			continue
+		}
+
+		adv.Refs[name] = hash
+	}
+
+	return adv, nil
+}
+
+func setAuth(req *http.Request, credentials *GitCredentials) {
+	if credentials != nil {
+		req.SetBasicAuth(credentials.Username, credentials.Secret())
+	}
+}
+
+// Turn a branch name into a fully qualified ref name
+func BranchRef(branch string) string {
+	if strings.HasPrefix(branch, "refs/") {
+		return branch
+	}
+
+	return "refs/heads/" + branch
+}
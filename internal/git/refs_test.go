@@ -0,0 +1,116 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testHashA = "1111111111111111111111111111111111111111"
+	testHashB = "2222222222222222222222222222222222222222"
+)
+
+func TestParseRefAdvertisement(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		refs     map[string]string
+		caps     map[string]string
+		hasError bool
+	}{
+		{
+			name: "refs with capabilities",
+			data: encodePktLine("# service=git-receive-pack\n") + flushPkt +
+				encodePktLine(testHashA+" refs/heads/main\x00report-status delete-refs agent=git/2.43.0\n") +
+				encodePktLine(testHashB+" refs/heads/feature\n") +
+				flushPkt,
+			refs: map[string]string{"refs/heads/main": testHashA, "refs/heads/feature": testHashB},
+			caps: map[string]string{"report-status": "", "delete-refs": "", "agent": "git/2.43.0"},
+		},
+		{
+			name: "empty repository",
+			data: encodePktLine("# service=git-receive-pack\n") + flushPkt +
+				encodePktLine(zeroHash+" capabilities^{}\x00report-status\n") +
+				flushPkt,
+			refs: map[string]string{},
+			caps: map[string]string{"report-status": ""},
+		},
+		{
+			name:     "wrong service",
+			data:     encodePktLine("# service=git-upload-pack\n") + flushPkt + flushPkt,
+			hasError: true,
+		},
+		{
+			name:     "missing flush after the announcement",
+			data:     encodePktLine("# service=git-receive-pack\n") + encodePktLine(testHashA+" refs/heads/main\n"),
+			hasError: true,
+		},
+		{
+			name: "invalid ref line",
+			data: encodePktLine("# service=git-receive-pack\n") + flushPkt +
+				encodePktLine("garbage\n") + flushPkt,
+			hasError: true,
+		},
+		{
+			name:     "truncated",
+			data:     encodePktLine("# service=git-receive-pack\n") + flushPkt,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adv, err := parseRefAdvertisement(strings.NewReader(tt.data), "git-receive-pack")
+			if tt.hasError {
+				if err == nil {
+					t.Fatal("parseRefAdvertisement() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRefAdvertisement() error = %v", err)
+			}
+			if !reflect.DeepEqual(adv.Refs, tt.refs) {
+				t.Errorf("refs = %v, want %v", adv.Refs, tt.refs)
+			}
+			if !reflect.DeepEqual(adv.Capabilities, tt.caps) {
+				t.Errorf("capabilities = %v, want %v", adv.Capabilities, tt.caps)
+			}
+		})
+	}
+}
+
+func TestDiscoverRefs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repo.git/info/refs" || r.URL.Query().Get("service") != "git-receive-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-git-receive-pack-advertisement")
+		w.Write([]byte(encodePktLine("# service=git-receive-pack\n") + flushPkt +
+			encodePktLine(testHashA+" refs/heads/main\x00report-status\n") + flushPkt))
+	}))
+	defer server.Close()
+
+	credentials := &GitCredentials{Username: "user", Password: "password", Token: "token"}
+	adv, err := DiscoverRefs(context.Background(), server.URL+"/repo.git/", "git-receive-pack", credentials)
+	if err != nil {
+		t.Fatalf("DiscoverRefs() error = %v", err)
+	}
+	if adv.Refs["refs/heads/main"] != testHashA || !adv.HasCapability("report-status") {
+		t.Fatalf("DiscoverRefs() = %+v", adv)
+	}
+
+	if _, err := DiscoverRefs(context.Background(), server.URL+"/repo.git", "git-receive-pack", nil); err == nil {
+		t.Fatal("DiscoverRefs() without credentials succeeded, want an error")
+	}
+}
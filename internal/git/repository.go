@@ -1,9 +1,16 @@
 package git
 
+import "context"
+
 type Repository interface {
 	// Clean up the repository
 	Close() error
 
 	// Push an empty commit to the repository and return the commit hash
-	PushEmptyCommit() (string, error)
+	PushEmptyCommit(ctx context.Context) (string, error)
+
+	// Bring the local state up to date with the remote branch
+	//
+	// This is used to recover after a failed push without cloning again.
+	Sync(ctx context.Context) error
 }
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Default SSH port of the Artemis integrated version control
+const DefaultSSHPort = 7921
+
+// Default template for turning a repository URI into its SSH counterpart
+//
+// {host} is the host of the HTTPS URI, {port} the configured SSH port and
+// {path} the repository path without the /git/ prefix Artemis serves HTTPS
+// repositories under. {user} is the user of the HTTPS URI.
+const DefaultSSHURLTemplate = "ssh://git@{host}:{port}/{path}"
+
+// Settings for cloning and pushing over SSH instead of HTTPS
+type SSHConfig struct {
+	// Template of the SSH URI, see DefaultSSHURLTemplate
+	URLTemplate string
+	Port        int
+
+	// Private key to authenticate with, the ssh-agent is used if empty
+	KeyFile       string
+	KeyPassphrase string
+
+	// known_hosts files to check host keys against, the defaults of
+	// ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts are used if empty
+	KnownHosts []string
+}
+
+// Turn the HTTPS repository URI into the SSH URI of the instance
+func SSHURL(httpsURL string, config *SSHConfig) (string, error) {
+	u, err := url.Parse(httpsURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URI: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid repository URI %q: missing host", httpsURL)
+	}
+
+	template := config.URLTemplate
+	if template == "" {
+		template = DefaultSSHURLTemplate
+	}
+	port := config.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+	path = strings.TrimPrefix(path, "git/")
+
+	user := ""
+	if u.User != nil {
+		user = u.User.Username()
+	}
+
+	return strings.NewReplacer(
+		"{host}", u.Hostname(),
+		"{port}", strconv.Itoa(port),
+		"{path}", path,
+		"{user}", user,
+	).Replace(template), nil
+}
@@ -0,0 +1,29 @@
+package retrigger
+
+import (
+	"context"
+	"time"
+)
+
+// Return a context that outlives ctx by the given grace period
+//
+// This lets an operation that is already in flight finish after a shutdown
+// was requested, while still bounding how long we wait for it.
+func withGracePeriod(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-graceCtx.Done():
+		}
+	})
+
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,119 @@
+package retrigger
+
+import (
+	"time"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+)
+
+// The state of a retrigger run
+type State int
+
+const (
+	// Setting up the client, websocket and repository
+	StateStarting State = iota
+	// Pushing a new commit
+	StatePushing
+	// Waiting for Artemis to pick up the pushed commit
+	StateWaitingForSubmission
+	// Waiting for the build of the submission to finish
+	StateWaitingForResult
+	// Waiting a moment before pushing again
+	StateCooldown
+	// The desired percentage was reached or the run was stopped
+	StateDone
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StatePushing:
+		return "pushing"
+	case StateWaitingForSubmission:
+		return "waiting for submission"
+	case StateWaitingForResult:
+		return "waiting for result"
+	case StateCooldown:
+		return "cooldown"
+	case StateDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// The kind of an Event
+type EventType int
+
+const (
+	// The runner moved to a new state, see Event.State
+	EventStateChanged EventType = iota
+	// The runner is set up and starts retriggering
+	EventStarted
+	// A commit was pushed, see Event.CommitHash
+	EventPushed
+	// Artemis started building a submission
+	EventSubmission
+	// Artemis sent a submission although we were already waiting for a result
+	EventUnexpectedSubmission
+	// A new result arrived, see Event.Percentage
+	EventResult
+	// The desired percentage was already reached before pushing anything
+	EventAlreadyReached
+	// The desired percentage was reached, see Event.Percentage
+	EventReached
+	// The websocket reconnected, see Event.Downtime
+	EventReconnected
+	// Something failed, see Event.Err. Failures of the websocket are
+	// reported without interrupting the run, others cause a retry.
+	EventError
+	// No result arrived in time, the run is retried
+	EventTimeout
+	// The run is retried after a failure, see Event.Delay
+	EventRetrying
+	// A submission of another participation or commit arrived, see
+	// Event.ParticipationID and Event.CommitHash
+	EventIgnoredSubmission
+	// A result of another participation or commit arrived, see
+	// Event.ParticipationID and Event.CommitHash
+	EventIgnoredResult
+	// The build of the pushed commit failed, see Event.BuildFailure and
+	// Event.BuildLog
+	EventBuildFailed
+)
+
+type Event struct {
+	Type EventType
+
+	// The state the runner is in after this event, always StateStarting for
+	// events of a shared Session
+	State State
+	// The pushed commit for EventPushed, the commit of the submission or
+	// result for EventIgnoredSubmission and EventIgnoredResult
+	CommitHash string
+	// The participation of the submission or result for
+	// EventIgnoredSubmission and EventIgnoredResult
+	ParticipationID int
+	// The received percentage for EventResult and EventReached
+	Percentage int
+	// How long the websocket was down for EventReconnected
+	Downtime time.Duration
+	// The delay before the next attempt for EventRetrying
+	Delay time.Duration
+	// The failure for EventError
+	Err error
+	// The likely cause for EventBuildFailed
+	BuildFailure artemis.BuildFailure
+	// The part of the build log explaining the failure for EventBuildFailed
+	BuildLog []*artemis.BuildLogEntry
+}
+
+// Summary of what a run did so far
+type Stats struct {
+	StartedAt      time.Time
+	Retriggers     int
+	Results        int
+	LastPercentage int
+	BestPercentage int
+}
@@ -0,0 +1,450 @@
+package retrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+	"github.com/coronon/artemisbot/internal/config"
+	"github.com/coronon/artemisbot/internal/flaky"
+	"github.com/coronon/artemisbot/internal/git"
+	"github.com/coronon/artemisbot/internal/sockjs"
+)
+
+const (
+	// How long to wait for a result before starting over
+	resultTimeout = 10 * time.Minute
+	// Delay between receiving a result and pushing the next commit
+	cooldownDelay = 1 * time.Second
+	// Delay before retrying after a failed iteration
+	retryDelay = 5 * time.Second
+	// How long a push that is in flight may take after a shutdown was requested
+	pushGracePeriod = 30 * time.Second
+	// Lines of the build log reported for a failed build by default
+	defaultBuildLogLines = 20
+)
+
+// Returned by Run when the pushed code does not compile
+var ErrCompilationFailed = errors.New("the submission does not compile, fix it before retriggering")
+
+type Config struct {
+	// Share the client and websocket with other runners, a session of its
+	// own is created from the fields below if nil
+	Session *Session
+
+	// The Artemis instance the exercise lives on
+	Artemis *config.Config
+
+	Username string
+	Password string
+	// An existing JWT to use instead of a password login
+	Token string
+	// Credentials for pushing to the participation repository
+	GitCredentials *git.GitCredentials
+	// Get a VCS access token through the Artemis API if none is configured
+	FetchVCSToken bool
+	// How to pick the author of the commits
+	Author artemis.AuthorConfig
+
+	WorkDir           string
+	CourseID          string
+	TaskID            string
+	DesiredPercentage int
+	GitBackend        string
+	// Lines of the build log reported for a failed build, 20 if zero
+	BuildLogLines int
+	// Record the test outcomes of every result under HistoryKey if set
+	History    *flaky.History
+	HistoryKey string
+}
+
+// Retriggers a single exercise until the desired percentage is reached
+//
+// The client, websocket and repository survive failed iterations and only
+// the part that broke is set up again before the next one. Runners only
+// share their Session, so several of them can run in the same process.
+type Runner struct {
+	config  Config
+	onEvent func(Event)
+
+	mtx   sync.Mutex
+	state State
+	stats Stats
+
+	session     *Session
+	ownsSession bool
+	task        *artemis.Task
+	route       *route
+	repoBroken  bool
+}
+
+// Create a runner that reports its progress to onEvent
+//
+// onEvent is called from Run and, if the runner creates its own session, from
+// the goroutine of that session for websocket events and ignored build
+// events. It must be safe for concurrent use and may be nil.
+func NewRunner(config Config, onEvent func(Event)) *Runner {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+
+	r := &Runner{
+		config:  config,
+		onEvent: onEvent,
+		state:   StateStarting,
+		session: config.Session,
+	}
+	if r.session == nil {
+		r.session = NewSession(SessionConfig{
+			Artemis:  config.Artemis,
+			Username: config.Username,
+			Password: config.Password,
+			Token:    config.Token,
+			WorkDir:  config.WorkDir,
+		}, r.emit)
+		r.ownsSession = true
+	}
+
+	return r
+}
+
+// The current state of the runner
+func (r *Runner) State() State {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.state
+}
+
+// What the runner did so far
+func (r *Runner) Stats() Stats {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.stats
+}
+
+// Release the repository and the websocket connection if the session is
+// not shared
+func (r *Runner) Close() {
+	if r.route != nil {
+		r.session.unregister(r.route)
+		r.route = nil
+	}
+	if r.task != nil {
+		r.task.Cleanup()
+		r.task = nil
+	}
+	if r.ownsSession {
+		r.session.Close()
+	}
+}
+
+// Retrigger the task until the desired percentage is reached
+//
+// Failed iterations are retried. Returns ctx.Err() if the context was
+// cancelled and an error if the run cannot continue.
+func (r *Runner) Run(ctx context.Context) error {
+	r.mtx.Lock()
+	if r.stats.StartedAt.IsZero() {
+		r.stats.StartedAt = time.Now()
+	}
+	r.mtx.Unlock()
+
+	for {
+		shouldRunAgain, err := r.iterate(ctx)
+		if ctx.Err() != nil {
+			r.setState(StateDone)
+			return ctx.Err()
+		}
+		if !shouldRunAgain {
+			r.setState(StateDone)
+			return err
+		}
+
+		if err != nil {
+			r.emit(Event{Type: EventError, Err: err})
+		}
+		r.emit(Event{Type: EventRetrying, Delay: retryDelay})
+		select {
+		case <-ctx.Done():
+			r.setState(StateDone)
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (r *Runner) setState(state State) {
+	r.mtx.Lock()
+	changed := r.state != state
+	r.state = state
+	r.mtx.Unlock()
+
+	if changed {
+		r.emit(Event{Type: EventStateChanged})
+	}
+}
+
+func (r *Runner) emit(event Event) {
+	event.State = r.State()
+	r.onEvent(event)
+}
+
+// Create or repair everything needed for an iteration
+//
+// Returns the websocket connection build events are routed from.
+func (r *Runner) prepare(ctx context.Context) (*sockjs.SockJSClient, error) {
+	// Client and websocket
+	client, ws, err := r.session.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Task and repository
+	if r.task == nil {
+		log.Debug("Creating a new Artemis task...")
+		r.task, err = artemis.NewRetriggerTask(
+			ctx,
+			client,
+			r.config.CourseID,
+			r.config.TaskID,
+			r.config.GitCredentials,
+			r.config.DesiredPercentage,
+			r.config.GitBackend,
+			r.config.FetchVCSToken,
+			r.config.Author,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not create a new Artemis task: %w", err)
+		}
+		log.Debug("Artemis task created")
+	} else if r.repoBroken {
+		log.Debug("Repairing the repository...")
+		if err = r.task.Repair(ctx); err != nil {
+			return nil, fmt.Errorf("could not repair the repository: %w", err)
+		}
+	}
+	r.repoBroken = false
+
+	// Start receiving the build events of the task
+	if r.route == nil {
+		r.route = r.session.register(r.task)
+	}
+
+	return ws, nil
+}
+
+// Run one iteration and report whether another one is needed
+func (r *Runner) iterate(ctx context.Context) (bool, error) {
+	r.setState(StateStarting)
+	ws, err := r.prepare(ctx)
+	if err != nil {
+		// A supplied token cannot be renewed, so retrying will not help
+		var expired *artemis.TokenExpiredError
+		if errors.As(err, &expired) {
+			return false, err
+		}
+
+		// Without a task we never got far enough for a retry to help
+		return r.task != nil, err
+	}
+	task := r.task
+
+	// Ensure that the desired percentage is not already reached
+	if task.CurrentPercentage >= task.DesiredPercentage {
+		r.setState(StateDone)
+		r.emit(Event{Type: EventAlreadyReached, Percentage: task.CurrentPercentage})
+		return false, nil
+	}
+
+	r.emit(Event{Type: EventStarted})
+	timer := time.NewTimer(1 * time.Millisecond)
+	timeout := time.NewTimer(resultTimeout)
+	defer timer.Stop()
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timeout.C:
+			// We might have missed the result, so push again. The websocket is
+			// shared with other runners and repairs itself, so it stays open.
+			r.emit(Event{Type: EventTimeout})
+			return true, nil
+		case <-timer.C:
+			timeout.Stop()
+			if err := r.push(ctx, task); err != nil {
+				if ctx.Err() != nil {
+					return false, ctx.Err()
+				}
+				r.repoBroken = true
+				return true, fmt.Errorf("could not retrigger the task: %w", err)
+			}
+			timeout.Reset(resultTimeout)
+		case submission := <-r.route.submissions:
+			r.handleSubmission(task, submission)
+		case result := <-r.route.results:
+			matched, reached, err := r.handleResult(ctx, task, result)
+			if err != nil {
+				return false, err
+			}
+			if reached {
+				return false, nil
+			}
+			if !matched {
+				continue
+			}
+
+			r.setState(StateCooldown)
+			timer.Reset(cooldownDelay)
+		case <-ws.Done():
+			return true, errors.New("websocket connection closed")
+		}
+	}
+}
+
+// Push a new commit, letting a push that already started finish during shutdown
+func (r *Runner) push(ctx context.Context, task *artemis.Task) error {
+	r.setState(StatePushing)
+
+	pushCtx, cancel := withGracePeriod(ctx, pushGracePeriod)
+	defer cancel()
+
+	hash, err := task.Retrigger(pushCtx)
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	r.stats.Retriggers++
+	r.mtx.Unlock()
+
+	r.setState(StateWaitingForSubmission)
+	r.emit(Event{Type: EventPushed, CommitHash: hash})
+
+	return nil
+}
+
+// Move on to waiting for the result once our submission is being built
+func (r *Runner) handleSubmission(task *artemis.Task, submission *artemis.Submission) {
+	if !task.MatchesSubmission(submission) {
+		r.emit(Event{
+			Type:            EventIgnoredSubmission,
+			ParticipationID: submission.ParticipationID(),
+			CommitHash:      submission.CommitHash,
+		})
+		return
+	}
+
+	if r.State() != StateWaitingForSubmission {
+		r.emit(Event{Type: EventUnexpectedSubmission})
+		return
+	}
+
+	r.setState(StateWaitingForResult)
+	r.emit(Event{Type: EventSubmission})
+}
+
+// Record a result and report whether it belongs to the last pushed commit
+// and whether the desired percentage is reached
+//
+// Returns ErrCompilationFailed if the build failed because the code does
+// not compile.
+func (r *Runner) handleResult(ctx context.Context, task *artemis.Task, result *artemis.Result) (bool, bool, error) {
+	if !task.MatchesResult(result) {
+		r.emit(Event{
+			Type:            EventIgnoredResult,
+			ParticipationID: result.ParticipationID(),
+			CommitHash:      result.CommitHash(),
+		})
+		return false, false, nil
+	}
+
+	newPercentage := result.Percentage()
+	r.mtx.Lock()
+	r.stats.Results++
+	r.stats.LastPercentage = newPercentage
+	r.stats.BestPercentage = max(r.stats.BestPercentage, newPercentage)
+	r.mtx.Unlock()
+
+	if result.BuildFailed() {
+		if failure := r.handleBuildFailure(ctx, task, result); failure == artemis.BuildFailureCompilation {
+			r.setState(StateDone)
+			return true, false, ErrCompilationFailed
+		}
+	} else {
+		r.recordAttempt(ctx, task, result)
+	}
+
+	if newPercentage >= task.DesiredPercentage {
+		r.setState(StateDone)
+		r.emit(Event{Type: EventReached, Percentage: newPercentage})
+		return true, true, nil
+	}
+
+	r.emit(Event{Type: EventResult, Percentage: newPercentage})
+	return true, false, nil
+}
+
+// Store the test outcomes of a result for the flaky test report
+func (r *Runner) recordAttempt(ctx context.Context, task *artemis.Task, result *artemis.Result) {
+	if r.config.History == nil || result.ID == 0 {
+		return
+	}
+
+	feedback, err := task.Feedback(ctx, result.ID)
+	if err != nil {
+		r.emit(Event{Type: EventError, Err: fmt.Errorf("could not get the feedback of the result: %w", err)})
+		return
+	}
+
+	attempt := &flaky.Attempt{
+		ResultID:   result.ID,
+		CommitHash: result.CommitHash(),
+		Time:       time.Now(),
+		Score:      result.Score,
+		Tests:      make(map[string]flaky.TestOutcome, len(feedback.Tests)),
+	}
+	if result.CompletionDate != nil {
+		attempt.Time = *result.CompletionDate
+	}
+	for _, test := range feedback.Tests {
+		attempt.Tests[test.Name] = flaky.TestOutcome{
+			Passed:  test.Passed,
+			Credits: test.Credits,
+		}
+	}
+
+	if err := r.config.History.Append(r.config.HistoryKey, attempt); err != nil {
+		r.emit(Event{Type: EventError, Err: err})
+	}
+}
+
+// Report the build log of a failed build and guess what went wrong
+func (r *Runner) handleBuildFailure(ctx context.Context, task *artemis.Task, result *artemis.Result) artemis.BuildFailure {
+	entries, err := task.BuildLogs(ctx, result.ID)
+	if err != nil {
+		r.emit(Event{Type: EventError, Err: fmt.Errorf("could not get the build log: %w", err)})
+		return artemis.BuildFailureUnknown
+	}
+
+	lines := r.config.BuildLogLines
+	if lines <= 0 {
+		lines = defaultBuildLogLines
+	}
+
+	failure := artemis.ClassifyBuildLog(entries)
+	r.emit(Event{
+		Type:         EventBuildFailed,
+		BuildFailure: failure,
+		BuildLog:     artemis.RelevantBuildLog(entries, lines),
+	})
+
+	return failure
+}
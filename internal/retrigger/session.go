@@ -0,0 +1,272 @@
+package retrigger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/coronon/artemisbot/internal/artemis"
+	"github.com/coronon/artemisbot/internal/config"
+	"github.com/coronon/artemisbot/internal/sockjs"
+)
+
+// How many build events are queued per task before dropping them
+const routeBuffer = 16
+
+type SessionConfig struct {
+	// The Artemis instance to connect to
+	Artemis *config.Config
+
+	Username string
+	Password string
+	// An existing JWT to use instead of a password login
+	Token string
+
+	WorkDir string
+}
+
+// An Artemis client and websocket shared by several runners
+//
+// Artemis publishes the submissions and results of all exercises of a user
+// on the same topics. The session subscribes to them once and routes every
+// build event by participation and commit to the task it belongs to, so
+// several exercises can be retriggered at the same time. Events that belong
+// to no task are reported as ignored.
+type Session struct {
+	config  SessionConfig
+	onEvent func(Event)
+
+	// Guards the client and the connection the dispatcher runs for
+	mtx    sync.Mutex
+	client *artemis.ArtemisClient
+	ws     *sockjs.SockJSClient
+
+	routesMtx sync.Mutex
+	routes    []*route
+}
+
+// Build events of a single task
+type route struct {
+	task        *artemis.Task
+	submissions chan *artemis.Submission
+	results     chan *artemis.Result
+}
+
+// Create a session that reports websocket events and ignored build events
+// to onEvent
+//
+// Nothing is connected until the first runner needs it. onEvent is called
+// from a separate goroutine and may be nil.
+func NewSession(config SessionConfig, onEvent func(Event)) *Session {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+
+	return &Session{
+		config:  config,
+		onEvent: onEvent,
+	}
+}
+
+// Disconnect the websocket
+func (s *Session) Close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+		s.ws = nil
+	}
+}
+
+// Create or repair the client and websocket and start routing build events
+//
+// Returns the client and the websocket connection events are routed from.
+func (s *Session) connect(ctx context.Context) (*artemis.ArtemisClient, *sockjs.SockJSClient, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var err error
+
+	// Client
+	if s.client == nil {
+		log.Debug("Bootsrapping Artemis client...")
+		if s.client, err = s.newClient(ctx); err != nil {
+			return nil, nil, fmt.Errorf("could not create an Artemis client: %w", err)
+		}
+		log.Debug("Artemis client bootstrapped")
+	} else if !s.client.IsAuthenticated() {
+		log.Debug("Re-authenticating with Artemis...")
+		if err = s.client.Reauthenticate(ctx); err != nil {
+			return nil, nil, fmt.Errorf("could not re-authenticate: %w", err)
+		}
+	}
+
+	// Websocket
+	if s.client.WS.IsClosed() {
+		log.Debug("Reconnecting to the Artemis websocket...")
+		if err = s.client.ConnectWebsocket(ctx); err != nil {
+			return nil, nil, fmt.Errorf("could not reconnect the websocket: %w", err)
+		}
+	}
+
+	// Start listening for build events on a new connection
+	if s.ws != s.client.WS {
+		ws := s.client.WS
+		submissions, err := ws.Subscribe(artemis.TopicNewSubmissions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not subscribe to new submissions: %w", err)
+		}
+		results, err := ws.Subscribe(artemis.TopicNewResults)
+		if err != nil {
+			submissions.Unsubscribe()
+			return nil, nil, fmt.Errorf("could not subscribe to new results: %w", err)
+		}
+
+		s.ws = ws
+		go s.dispatch(ws, submissions, results)
+	}
+
+	return s.client, s.ws, nil
+}
+
+// Create an authenticated client using the configured token or password
+func (s *Session) newClient(ctx context.Context) (*artemis.ArtemisClient, error) {
+	if s.config.Token == "" {
+		return artemis.NewArtemisClient(ctx, s.config.Artemis, s.config.Username, s.config.Password, s.config.WorkDir)
+	}
+
+	client := artemis.NewArtemisHTTPClient(s.config.Artemis, s.config.Username, s.config.Password, s.config.WorkDir)
+	if err := client.UseToken(s.config.Token); err != nil {
+		return nil, err
+	}
+	if err := client.ConnectWebsocket(ctx); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Start routing the build events of task
+func (s *Session) register(task *artemis.Task) *route {
+	r := &route{
+		task:        task,
+		submissions: make(chan *artemis.Submission, routeBuffer),
+		results:     make(chan *artemis.Result, routeBuffer),
+	}
+
+	s.routesMtx.Lock()
+	s.routes = append(s.routes, r)
+	s.routesMtx.Unlock()
+
+	return r
+}
+
+// Stop routing build events to r
+func (s *Session) unregister(r *route) {
+	s.routesMtx.Lock()
+	defer s.routesMtx.Unlock()
+
+	for i, other := range s.routes {
+		if other == r {
+			s.routes = append(s.routes[:i], s.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Find the task a build event belongs to, nil if there is none
+//
+// Events are matched by participation first and by commit if Artemis did
+// not send the participation. With a single task, events carrying neither
+// are assumed to belong to it.
+func (s *Session) lookup(participationID int, commitHash string) *route {
+	s.routesMtx.Lock()
+	defer s.routesMtx.Unlock()
+
+	if participationID != 0 {
+		for _, r := range s.routes {
+			if r.task.ParticipationID == participationID {
+				return r
+			}
+		}
+		return nil
+	}
+
+	if commitHash != "" {
+		for _, r := range s.routes {
+			if r.task.LastCommitHash() == commitHash {
+				return r
+			}
+		}
+		return nil
+	}
+
+	if len(s.routes) == 1 {
+		return s.routes[0]
+	}
+	return nil
+}
+
+// Route the build events of a connection until it is closed
+func (s *Session) dispatch(ws *sockjs.SockJSClient, submissions, results *sockjs.Subscription) {
+	for {
+		select {
+		case <-ws.Done():
+			return
+		case msg := <-submissions.Messages():
+			submission, err := sockjs.Decode[artemis.Submission](msg)
+			if err != nil {
+				s.onEvent(Event{Type: EventError, Err: fmt.Errorf("could not handle websocket message: %w", err)})
+				continue
+			}
+
+			r := s.lookup(submission.ParticipationID(), submission.CommitHash)
+			if r == nil {
+				s.onEvent(Event{
+					Type:            EventIgnoredSubmission,
+					ParticipationID: submission.ParticipationID(),
+					CommitHash:      submission.CommitHash,
+				})
+				continue
+			}
+			deliverEvent(s, r.submissions, &submission, r.task)
+		case msg := <-results.Messages():
+			result, err := sockjs.Decode[artemis.Result](msg)
+			if err != nil {
+				s.onEvent(Event{Type: EventError, Err: fmt.Errorf("could not handle websocket message: %w", err)})
+				continue
+			}
+
+			r := s.lookup(result.ParticipationID(), result.CommitHash())
+			if r == nil {
+				s.onEvent(Event{
+					Type:            EventIgnoredResult,
+					ParticipationID: result.ParticipationID(),
+					CommitHash:      result.CommitHash(),
+				})
+				continue
+			}
+			deliverEvent(s, r.results, &result, r.task)
+		case err := <-ws.Errors():
+			s.onEvent(Event{Type: EventError, Err: fmt.Errorf("websocket error: %w", err)})
+		case event := <-ws.Reconnected():
+			s.onEvent(Event{Type: EventReconnected, Downtime: event.Downtime})
+		}
+	}
+}
+
+// Queue a build event without blocking the events of other tasks
+func deliverEvent[T any](s *Session, ch chan T, item T, task *artemis.Task) {
+	select {
+	case ch <- item:
+	default:
+		s.onEvent(Event{
+			Type: EventError,
+			Err:  fmt.Errorf("dropped a build event of exercise %s, too many are queued", task.TaskID),
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package sockjs
+
+import (
+	"fmt"
+)
+
+// What to do when a consumer does not keep up with delivered items
+type OverflowPolicy int
+
+const (
+	// Wait for the consumer, which pauses reading from the connection
+	OverflowBlock OverflowPolicy = iota
+	// Discard the oldest buffered item to make room for the new one
+	OverflowDropOldest
+	// Discard the new message and report an *OverflowError through Errors()
+	OverflowReportError
+)
+
+// Number of items buffered per channel when no buffer size is configured
+const defaultBufferSize = 64
+
+// Reported when a message was discarded because its channel was full
+type OverflowError struct {
+	Destination string
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("message to %s dropped: consumer is not keeping up", e.Destination)
+}
+
+// Deliver an item to a buffered channel according to the overflow policy
+//
+// Gives up once the client or the optional extra done channel is closed.
+// Returns false if the item was not delivered.
+func deliver[T any](c *SockJSClient, ch chan T, item T, policy OverflowPolicy, extraDone <-chan struct{}) bool {
+	// Fast path, there is room in the buffer
+	select {
+	case ch <- item:
+		return true
+	default:
+	}
+
+	switch policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case ch <- item:
+				return true
+			default:
+			}
+
+			select {
+			case <-ch:
+				c.dropped.Add(1)
+			default:
+			}
+		}
+	case OverflowReportError:
+		c.dropped.Add(1)
+		return false
+	}
+
+	// Let the heartbeat monitor know the silence is our own fault
+	c.delivering.Add(1)
+	defer c.delivering.Add(-1)
+
+	select {
+	case ch <- item:
+		return true
+	case <-c.doneChan:
+	case <-extraDone:
+	}
+
+	return false
+}
+
+// Number of messages and errors discarded because of the overflow policy
+func (c *SockJSClient) Dropped() int64 {
+	return c.dropped.Load()
+}
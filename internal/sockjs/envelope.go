@@ -0,0 +1,75 @@
+package sockjs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SockJS frame types
+const (
+	sockJSOpen      = 'o'
+	sockJSHeartbeat = 'h'
+	sockJSArray     = 'a'
+	sockJSMessage   = 'm'
+	sockJSClose     = 'c'
+)
+
+// A close frame sent by the SockJS server
+type SockJSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *SockJSCloseError) Error() string {
+	return fmt.Sprintf("SockJS connection closed by server: %d %s", e.Code, e.Reason)
+}
+
+// Decode a SockJS frame and return the payloads it carries
+//
+// Open and heartbeat frames carry no payloads. A close frame is returned as
+// a *SockJSCloseError.
+func DecodeSockJSFrame(data string) ([]string, error) {
+	if data == "" {
+		return nil, fmt.Errorf("empty SockJS frame")
+	}
+
+	switch data[0] {
+	case sockJSOpen, sockJSHeartbeat:
+		return nil, nil
+	case sockJSArray:
+		var payloads []string
+		if err := json.Unmarshal([]byte(data[1:]), &payloads); err != nil {
+			return nil, fmt.Errorf("failed to decode SockJS array frame: %w", err)
+		}
+
+		return payloads, nil
+	case sockJSMessage:
+		var payload string
+		if err := json.Unmarshal([]byte(data[1:]), &payload); err != nil {
+			return nil, fmt.Errorf("failed to decode SockJS message frame: %w", err)
+		}
+
+		return []string{payload}, nil
+	case sockJSClose:
+		var reason []interface{}
+		if err := json.Unmarshal([]byte(data[1:]), &reason); err != nil || len(reason) != 2 {
+			return nil, fmt.Errorf("failed to decode SockJS close frame: %s", data)
+		}
+
+		code, _ := reason[0].(float64)
+		text, _ := reason[1].(string)
+		return nil, &SockJSCloseError{Code: int(code), Reason: text}
+	default:
+		return nil, fmt.Errorf("unknown SockJS frame type %q", data[0])
+	}
+}
+
+// Encode payloads into a SockJS message sent by the client
+func EncodeSockJSFrame(payloads ...string) (string, error) {
+	data, err := json.Marshal(payloads)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,164 @@
+package sockjs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What to do once a connection is considered stale
+type StaleAction int
+
+const (
+	// Only report the stale connection through Errors()
+	StaleReport StaleAction = iota
+	// Close the client
+	StaleClose
+	// Drop the connection and reconnect according to the reconnect policy
+	StaleReconnect
+)
+
+type HeartbeatPolicy struct {
+	// Interval at which we offer to send heartbeats, 0 disables them
+	Send time.Duration
+	// Interval at which we want to receive heartbeats, 0 disables them
+	Receive time.Duration
+	// Factor applied to the negotiated receive interval before a silent
+	// connection is considered stale
+	Tolerance float64
+	// What to do with a stale connection
+	OnStale StaleAction
+}
+
+// The heartbeat policy used when none is configured
+func DefaultHeartbeatPolicy() *HeartbeatPolicy {
+	return &HeartbeatPolicy{
+		Send:      10 * time.Second,
+		Receive:   10 * time.Second,
+		Tolerance: 2,
+		OnStale:   StaleReport,
+	}
+}
+
+// Reported when the server has been silent for longer than negotiated
+type StaleConnectionError struct {
+	// Last time anything was received from the server
+	LastActivity time.Time
+	// The negotiated interval the server promised to send heartbeats in
+	Interval time.Duration
+}
+
+func (e *StaleConnectionError) Error() string {
+	return fmt.Sprintf(
+		"connection stale: nothing received for %s (heartbeat interval %s)",
+		time.Since(e.LastActivity).Round(time.Millisecond),
+		e.Interval,
+	)
+}
+
+// The heart-beat header we send with CONNECT
+func (p *HeartbeatPolicy) header() string {
+	return fmt.Sprintf("%d,%d", p.Send.Milliseconds(), p.Receive.Milliseconds())
+}
+
+// Negotiate the heartbeat intervals with the server's heart-beat header
+//
+// Returns the interval we have to send in and the interval the server will
+// send in, 0 means no heartbeats in that direction.
+func (p *HeartbeatPolicy) negotiate(serverHeader string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(serverHeader, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid heartbeat format")
+	}
+	serverSend, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	serverReceive, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	send := negotiateInterval(p.Send, time.Duration(serverReceive)*time.Millisecond)
+	receive := negotiateInterval(p.Receive, time.Duration(serverSend)*time.Millisecond)
+
+	return send, receive, nil
+}
+
+// Both sides have to agree to heartbeats, the slower one wins
+func negotiateInterval(ours, theirs time.Duration) time.Duration {
+	if ours <= 0 || theirs <= 0 {
+		return 0
+	}
+
+	return max(ours, theirs)
+}
+
+// Record that something was received from the server
+func (c *SockJSClient) markActivity() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// Time of the last data received from the server
+func (c *SockJSClient) LastActivity() time.Time {
+	return time.Unix(0, c.lastActivity.Load())
+}
+
+// Send heartbeats and watch the server's heartbeats until connDone is closed
+func (c *SockJSClient) runHeartbeat(connDone <-chan struct{}, send, receive time.Duration) {
+	var sendTicker, checkTicker <-chan time.Time
+	if send > 0 {
+		ticker := time.NewTicker(send)
+		defer ticker.Stop()
+		sendTicker = ticker.C
+	}
+
+	staleAfter := time.Duration(float64(receive) * c.heartbeat.Tolerance)
+	if staleAfter > 0 {
+		ticker := time.NewTicker(receive)
+		defer ticker.Stop()
+		checkTicker = ticker.C
+	}
+
+	isStale := false
+	for {
+		select {
+		case <-connDone:
+			return
+		case <-sendTicker:
+			c.SendPing()
+		case <-checkTicker:
+			// Nothing is read while we wait for a slow consumer
+			lastActivity := c.LastActivity()
+			if c.delivering.Load() > 0 || time.Since(lastActivity) <= staleAfter {
+				isStale = false
+				continue
+			}
+
+			// Report every stale period only once
+			if isStale {
+				continue
+			}
+			isStale = true
+
+			staleErr := &StaleConnectionError{
+				LastActivity: lastActivity,
+				Interval:     receive,
+			}
+			c.emitError(staleErr)
+			switch c.heartbeat.OnStale {
+			case StaleClose:
+				c.Close()
+				return
+			case StaleReconnect:
+				// The failing read triggers the reconnect
+				c.mtx.Lock()
+				c.dropCause = staleErr
+				c.ws.Close()
+				c.mtx.Unlock()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package sockjs
+
+import (
+	"context"
+	"time"
+)
+
+// Number of reconnect events kept for consumers that are not listening
+const reconnectEventBuffer = 16
+
+type ReconnectPolicy struct {
+	// Delay before the first attempt, doubled after every failed attempt
+	InitialDelay time.Duration
+	// Upper bound for the delay between attempts
+	MaxDelay time.Duration
+	// Give up after this many failed attempts, 0 means never
+	MaxAttempts int
+}
+
+// A sensible reconnect policy for long-running clients
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     1 * time.Minute,
+		MaxAttempts:  0,
+	}
+}
+
+type ReconnectEvent struct {
+	// The error that caused the connection to drop
+	Cause error
+	// Number of attempts it took to reconnect
+	Attempts int
+	// Time between losing and restoring the connection
+	Downtime time.Duration
+}
+
+// Reconnect with exponential backoff after the connection dropped
+//
+// Returns false if the client was closed or the policy gave up.
+func (c *SockJSClient) reconnect(cause error) bool {
+	policy := c.options.Reconnect
+	lostAt := time.Now()
+
+	// Stop the heartbeat of the dead connection
+	c.mtx.Lock()
+	if c.connDone != nil {
+		close(c.connDone)
+		c.connDone = nil
+	}
+	c.ws.Close()
+	c.mtx.Unlock()
+
+	delay := policy.InitialDelay
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-c.doneChan:
+			return false
+		case <-time.After(delay):
+		}
+
+		ctx, cancel := c.closingContext()
+		err := c.refreshHeaders(ctx)
+		if err == nil {
+			err = c.connect(ctx)
+		}
+		cancel()
+		if err == nil {
+			select {
+			case c.reconnectChan <- ReconnectEvent{
+				Cause:    cause,
+				Attempts: attempt,
+				Downtime: time.Since(lostAt),
+			}:
+			default:
+			}
+
+			return true
+		}
+
+		if c.IsClosed() {
+			return false
+		}
+		c.emitError(err)
+
+		delay *= 2
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+
+	return false
+}
+
+// Create a context that is cancelled when the client is closed
+func (c *SockJSClient) closingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.doneChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+func (c *SockJSClient) refreshHeaders(ctx context.Context) error {
+	if c.options.RefreshHeaders == nil {
+		return nil
+	}
+
+	headers, err := c.options.RefreshHeaders(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.headers = headers
+	return nil
+}
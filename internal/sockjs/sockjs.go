@@ -1,16 +1,16 @@
 package sockjs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/charmbracelet/log"
 	"github.com/gorilla/websocket"
 )
 
@@ -18,91 +18,137 @@ type SockJSMessage struct {
 	Command string                  `json:"command"`
 	Headers map[string]string       `json:"headers"`
 	Body    *map[string]interface{} `json:"body"`
+	// The undecoded frame body
+	RawBody []byte `json:"-"`
 }
 
-var sockJSRegex = regexp.MustCompile(`^a?\["(?P<command>.+?)\\n(?P<headers>(?:[a-zA-Z0-9-_/#,. ]+:[a-zA-Z0-9-_/#,. ]+\\n)*)\\n(?P<body>.*)\\u0000"]$`)
-
-// Parse a raw SockJS message
-func ParseSockJSMessage(data string) (*SockJSMessage, error) {
-	if data == "o" {
-		return nil, nil
-	}
-
-	if data == `a["\n"]` {
-		return nil, nil
+// Build a message from a STOMP frame
+//
+// The body is decoded if it is a JSON object, other bodies are only
+// available in RawBody.
+func newSockJSMessage(frame *Frame) *SockJSMessage {
+	msg := &SockJSMessage{
+		Command: frame.Command,
+		Headers: frame.Headers,
+		RawBody: frame.Body,
 	}
 
-	msg := SockJSMessage{}
-
-	// Parse command
-	matches := sockJSRegex.FindStringSubmatch(data)
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("failed to parse SockJS message: %s", data)
+	if len(frame.Body) > 0 {
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(frame.Body, &body); err == nil {
+			msg.Body = &body
+		}
 	}
 
-	msg.Command = matches[sockJSRegex.SubexpIndex("command")]
-
-	// Parse headers
-	msg.Headers = make(map[string]string)
-	headers := matches[sockJSRegex.SubexpIndex("headers")]
-	for _, header := range strings.Split(headers, `\n`) {
-		if header == "" {
-			continue
-		}
+	return msg
+}
 
-		parts := strings.Split(header, ":")
-		msg.Headers[parts[0]] = parts[1]
+// Parse a raw SockJS frame into the STOMP messages it carries
+//
+// Frames without STOMP content (open, heartbeat) yield no messages.
+func ParseSockJSMessage(data string) ([]*SockJSMessage, error) {
+	payloads, err := DecodeSockJSFrame(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse body
-	body := matches[sockJSRegex.SubexpIndex("body")]
-	if body != "" {
-		msg.Body = &map[string]interface{}{}
-		body = strings.ReplaceAll(body, `\"`, `"`)
-		err := json.Unmarshal([]byte(body), msg.Body)
+	messages := []*SockJSMessage{}
+	for _, payload := range payloads {
+		frames, err := DecodeFrames([]byte(payload))
 		if err != nil {
 			return nil, err
 		}
+
+		for _, frame := range frames {
+			messages = append(messages, newSockJSMessage(frame))
+		}
 	}
 
-	return &msg, nil
+	return messages, nil
+}
+
+type Options struct {
+	// Reconnect automatically when the connection drops, disabled if nil
+	Reconnect *ReconnectPolicy
+
+	// Heartbeat intervals and stale connection handling, uses
+	// DefaultHeartbeatPolicy() if nil
+	Heartbeat *HeartbeatPolicy
+
+	// Number of messages and errors buffered per channel, 64 if 0
+	BufferSize int
+	// What to do when a buffer is full
+	Overflow OverflowPolicy
+
+	// Called before every reconnect to refresh the handshake headers
+	// (e.g. an expired authentication cookie), optional
+	RefreshHeaders func(ctx context.Context) (http.Header, error)
 }
 
 type SockJSClient struct {
 	mtx        sync.Mutex
+	writeMtx   sync.Mutex
 	ws         *websocket.Conn
 	msgCounter atomic.Int64
 	sessionID  string
-
-	msgChan  chan *SockJSMessage
-	errChan  chan error
-	doneChan chan struct{}
-	isClosed bool
+	// Unix nanoseconds of the last data received from the server
+	lastActivity atomic.Int64
+	// Number of items discarded because of the overflow policy
+	dropped atomic.Int64
+	// Number of deliveries currently waiting for a consumer
+	delivering atomic.Int32
+
+	wsURL     string
+	headers   http.Header
+	options   Options
+	heartbeat *HeartbeatPolicy
+	// Set when we dropped the connection on purpose and already reported why
+	dropCause error
+	// Set once a DISCONNECT was sent, the server closing the connection is
+	// expected then
+	isDisconnecting bool
+	subscriptions   []*Subscription
+	receipts        map[string]chan struct{}
+	// Closed when the current connection is replaced or shut down
+	connDone chan struct{}
+
+	errChan       chan error
+	reconnectChan chan ReconnectEvent
+	doneChan      chan struct{}
+	isClosed      bool
 }
 
-func NewSockJSClient(wsURL string, headers http.Header) (*SockJSClient, error) {
+// Connect to a SockJS server and complete the STOMP handshake
+//
+// The context only bounds connecting, the client keeps running until it is
+// closed.
+func NewSockJSClient(ctx context.Context, wsURL string, headers http.Header, options *Options) (*SockJSClient, error) {
 	client := &SockJSClient{
 		mtx:        sync.Mutex{},
+		writeMtx:   sync.Mutex{},
 		msgCounter: atomic.Int64{},
 
-		msgChan:  make(chan *SockJSMessage),
-		errChan:  make(chan error),
-		doneChan: make(chan struct{}),
-		isClosed: false,
-	}
+		wsURL:    wsURL,
+		headers:  headers,
+		receipts: map[string]chan struct{}{},
 
-	ws, _, err := websocket.DefaultDialer.Dial(
-		wsURL,
-		headers,
-	)
-	if err != nil {
-		return nil, err
+		reconnectChan: make(chan ReconnectEvent, reconnectEventBuffer),
+		doneChan:      make(chan struct{}),
+		isClosed:      false,
+	}
+	if options != nil {
+		client.options = *options
+	}
+	if client.options.BufferSize <= 0 {
+		client.options.BufferSize = defaultBufferSize
+	}
+	client.errChan = make(chan error, client.options.BufferSize)
+	client.heartbeat = client.options.Heartbeat
+	if client.heartbeat == nil {
+		client.heartbeat = DefaultHeartbeatPolicy()
 	}
 
-	client.ws = ws
-
-	client.sessionID, err = client.handleConnect()
-	if err != nil {
+	if err := client.connect(ctx); err != nil {
 		return nil, err
 	}
 
@@ -112,6 +158,10 @@ func NewSockJSClient(wsURL string, headers http.Header) (*SockJSClient, error) {
 }
 
 // Closes the websocket connection.
+//
+// Closing never blocks, even if consumers stopped reading. The message and
+// error channels are not closed and keep any buffered items, use Done() to
+// detect that the client has shut down.
 func (c *SockJSClient) Close() {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
@@ -120,17 +170,54 @@ func (c *SockJSClient) Close() {
 		return
 	}
 
+	c.isClosed = true
 	close(c.doneChan)
+	for _, sub := range c.subscriptions {
+		close(sub.doneChan)
+	}
+	c.subscriptions = nil
+	if c.connDone != nil {
+		close(c.connDone)
+		c.connDone = nil
+	}
 	c.ws.Close()
-	close(c.msgChan)
-	close(c.errChan)
 }
 
-// Returns a channel that receives messages from the server.
+// Gracefully end the STOMP session and close the connection
 //
-// Protocol messages are handled internally and are not sent to the channel.
-func (c *SockJSClient) Messages() <-chan *SockJSMessage {
-	return c.msgChan
+// Waits for the server to acknowledge the DISCONNECT until ctx ends, the
+// connection is closed in any case.
+func (c *SockJSClient) Disconnect(ctx context.Context) error {
+	c.mtx.Lock()
+	if c.isClosed {
+		c.mtx.Unlock()
+		return nil
+	}
+	c.isDisconnecting = true
+	c.mtx.Unlock()
+	defer c.Close()
+
+	receipt, err := c.SendFrameWithReceipt(NewFrame("DISCONNECT", nil, nil))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-receipt:
+		return nil
+	case <-c.doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check if the connection has been closed
+func (c *SockJSClient) IsClosed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.isClosed
 }
 
 // Returns a channel that receives errors from the connection.
@@ -138,6 +225,14 @@ func (c *SockJSClient) Errors() <-chan error {
 	return c.errChan
 }
 
+// Returns a channel that receives an event after every successful reconnect.
+//
+// Messages sent by the server while the connection was down are lost.
+// Events are dropped if the channel is not drained.
+func (c *SockJSClient) Reconnected() <-chan ReconnectEvent {
+	return c.reconnectChan
+}
+
 // Returns a channel that is closed when the connection is closed.
 func (c *SockJSClient) Done() <-chan struct{} {
 	return c.doneChan
@@ -145,107 +240,353 @@ func (c *SockJSClient) Done() <-chan struct{} {
 
 // Send a ping message to the server
 func (c *SockJSClient) SendPing() error {
-	return c.ws.WriteMessage(websocket.TextMessage, []byte(`["\n"]`))
+	return c.write(`["\n"]`)
+}
+
+// Send a STOMP frame to the server
+func (c *SockJSClient) SendFrame(frame *Frame) error {
+	message, err := EncodeSockJSFrame(string(frame.Encode()))
+	if err != nil {
+		return err
+	}
+
+	return c.write(message)
+}
+
+// Send a STOMP frame and return a channel that is closed once the server
+// acknowledged it with a RECEIPT frame
+func (c *SockJSClient) SendFrameWithReceipt(frame *Frame) (<-chan struct{}, error) {
+	receiptID := fmt.Sprintf("receipt-%d", c.msgCounter.Add(1))
+	frame.Headers["receipt"] = receiptID
+
+	receipt := make(chan struct{})
+	c.mtx.Lock()
+	c.receipts[receiptID] = receipt
+	c.mtx.Unlock()
+
+	if err := c.SendFrame(frame); err != nil {
+		c.mtx.Lock()
+		delete(c.receipts, receiptID)
+		c.mtx.Unlock()
+
+		return nil, err
+	}
+
+	return receipt, nil
 }
 
 // Subscribe to a SockJS destination
-func (c *SockJSClient) Subscribe(destination string) error {
-	message := fmt.Sprintf(
-		`["SUBSCRIBE\nid:%s\ndestination:%s\n\n\u0000"]`,
-		fmt.Sprintf("%s-%d", c.sessionID, c.msgCounter.Add(1)),
-		destination,
-	)
+//
+// The subscription is renewed automatically after a reconnect.
+func (c *SockJSClient) Subscribe(destination string) (*Subscription, error) {
+	c.mtx.Lock()
+	if c.isClosed {
+		c.mtx.Unlock()
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	sub := &Subscription{
+		ID:          fmt.Sprintf("%s-%d", c.sessionID, c.msgCounter.Add(1)),
+		Destination: destination,
+
+		client:   c,
+		msgChan:  make(chan *SockJSMessage, c.options.BufferSize),
+		doneChan: make(chan struct{}),
+	}
+	c.subscriptions = append(c.subscriptions, sub)
+	c.mtx.Unlock()
+
+	if err := c.SendFrame(subscribeFrame(sub)); err != nil {
+		c.removeSubscription(sub)
+		return nil, err
+	}
 
-	return c.ws.WriteMessage(websocket.TextMessage, []byte(message))
+	return sub, nil
 }
 
-// Setup protocol authentication, heartbeat and return the session ID
-func (c *SockJSClient) handleConnect() (string, error) {
-	c.ws.ReadMessage() // initial o
+// Forget a subscription and end it, returns false if it was already gone
+func (c *SockJSClient) removeSubscription(sub *Subscription) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 
-	// Send CONNECT message
-	c.ws.WriteMessage(websocket.TextMessage, []byte(`["CONNECT\naccept-version:1.2\nheart-beat:10000,10000\n\n\u0000"]`))
-	messageType, data, err := c.ws.ReadMessage()
-	if err != nil {
-		return "", err
+	for i, existing := range c.subscriptions {
+		if existing == sub {
+			c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+			close(sub.doneChan)
+			return true
+		}
 	}
-	if messageType != websocket.TextMessage {
-		return "", fmt.Errorf("unexpected message type %d", messageType)
+
+	return false
+}
+
+// Find the subscription a message was sent to
+func (c *SockJSClient) findSubscription(id string) *Subscription {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, sub := range c.subscriptions {
+		if sub.ID == id {
+			return sub
+		}
 	}
 
-	// Parse session ID
-	msg, err := ParseSockJSMessage(string(data))
+	return nil
+}
+
+func subscribeFrame(sub *Subscription) *Frame {
+	return NewFrame("SUBSCRIBE", map[string]string{
+		"id":          sub.ID,
+		"destination": sub.Destination,
+	}, nil)
+}
+
+// Write a raw message to the current connection
+func (c *SockJSClient) write(message string) error {
+	c.mtx.Lock()
+	ws := c.ws
+	c.mtx.Unlock()
+
+	return writeMessage(&c.writeMtx, ws, message)
+}
+
+// Websocket connections support only one concurrent writer
+func writeMessage(mtx *sync.Mutex, ws *websocket.Conn, message string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return ws.WriteMessage(websocket.TextMessage, []byte(message))
+}
+
+// Dial the server, run the handshake and make the result the current connection
+func (c *SockJSClient) connect(ctx context.Context) error {
+	ws, _, err := websocket.DefaultDialer.DialContext(
+		ctx,
+		c.wsURL,
+		c.headers,
+	)
 	if err != nil {
-		return "", err
+		return err
 	}
-	sessionID, ok := msg.Headers["session"]
-	if !ok {
-		return "", fmt.Errorf("session ID not found in CONNECT message")
+
+	// Abort the handshake reads if the context ends
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	sessionID, sendInterval, receiveInterval, err := c.handleConnect(ws)
+	stop()
+	if err != nil {
+		ws.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
 	}
 
-	// Parse heartbeat
-	heartbeat, ok := msg.Headers["heart-beat"]
-	if !ok {
-		return "", fmt.Errorf("heartbeat not found in CONNECT message")
+	c.mtx.Lock()
+	if c.isClosed {
+		c.mtx.Unlock()
+		ws.Close()
+		return fmt.Errorf("client closed while connecting")
 	}
-	heartbeatParts := strings.Split(heartbeat, ",")
-	if len(heartbeatParts) != 2 {
-		return "", fmt.Errorf("invalid heartbeat format")
+	if c.connDone != nil {
+		close(c.connDone)
 	}
-	heartbeatSendInterval, err := strconv.Atoi(heartbeatParts[0])
-	if err != nil {
-		return "", err
+	c.ws = ws
+	c.sessionID = sessionID
+	c.connDone = make(chan struct{})
+	connDone := c.connDone
+	subscriptions := append([]*Subscription{}, c.subscriptions...)
+	c.mtx.Unlock()
+
+	// Renew subscriptions of the previous connection
+	for _, sub := range subscriptions {
+		if err := c.SendFrame(subscribeFrame(sub)); err != nil {
+			return err
+		}
 	}
 
 	// Start heartbeat
-	go func() {
-		interval := time.NewTicker(time.Duration(heartbeatSendInterval) * time.Millisecond)
-		defer interval.Stop()
+	c.markActivity()
+	go c.runHeartbeat(connDone, sendInterval, receiveInterval)
 
-		for {
-			select {
-			case <-c.Done():
-				return
-			case <-interval.C:
-				c.SendPing()
+	return nil
+}
+
+// Setup protocol authentication and return the session ID and the
+// negotiated heartbeat intervals for sending and receiving
+func (c *SockJSClient) handleConnect(ws *websocket.Conn) (string, time.Duration, time.Duration, error) {
+	// Send CONNECT message
+	connectFrame := NewFrame("CONNECT", map[string]string{
+		"accept-version": "1.2",
+		"heart-beat":     c.heartbeat.header(),
+	}, nil)
+	message, err := EncodeSockJSFrame(string(connectFrame.Encode()))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if err := writeMessage(&c.writeMtx, ws, message); err != nil {
+		return "", 0, 0, err
+	}
+
+	// Wait for the server to accept, skipping the open frame and heartbeats
+	var connected *SockJSMessage
+	for connected == nil {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if messageType != websocket.TextMessage {
+			return "", 0, 0, fmt.Errorf("unexpected message type %d", messageType)
+		}
+
+		messages, err := ParseSockJSMessage(string(data))
+		if err != nil {
+			return "", 0, 0, err
+		}
+		for _, msg := range messages {
+			switch msg.Command {
+			case "CONNECTED":
+				connected = msg
+			case "ERROR":
+				return "", 0, 0, newStompError(msg)
 			}
 		}
-	}()
+	}
+
+	// Parse session ID
+	sessionID, ok := connected.Headers["session"]
+	if !ok {
+		return "", 0, 0, fmt.Errorf("session ID not found in CONNECT message")
+	}
+
+	// Parse heartbeat, a missing header means the server wants none
+	heartbeat, ok := connected.Headers["heart-beat"]
+	if !ok {
+		heartbeat = "0,0"
+	}
+	sendInterval, receiveInterval, err := c.heartbeat.negotiate(heartbeat)
+	if err != nil {
+		return "", 0, 0, err
+	}
 
-	return sessionID, nil
+	return sessionID, sendInterval, receiveInterval, nil
+}
+
+func newStompError(msg *SockJSMessage) *StompError {
+	return &StompError{
+		Message: msg.Headers["message"],
+		Body:    string(msg.RawBody),
+	}
 }
 
 func (c *SockJSClient) handleProtocol() {
 	for {
-		messageType, data, err := c.ws.ReadMessage()
 		c.mtx.Lock()
+		ws := c.ws
+		c.mtx.Unlock()
+
+		messageType, data, err := ws.ReadMessage()
+		if err == nil {
+			c.markActivity()
+		}
+		if err == nil && messageType == websocket.TextMessage {
+			err = c.handleFrame(string(data))
+		}
 		if err != nil {
-			if c.isClosed {
-				c.mtx.Unlock()
+			c.mtx.Lock()
+			isClosed := c.isClosed
+			isDisconnecting := c.isDisconnecting
+			dropCause := c.dropCause
+			c.dropCause = nil
+			c.mtx.Unlock()
+
+			if isClosed {
+				return
+			}
+			if isDisconnecting {
+				c.Close()
 				return
 			}
 
-			c.errChan <- err
-			c.mtx.Unlock()
+			// A failed read leaves the connection unusable
+			if dropCause != nil {
+				err = dropCause
+			} else {
+				c.emitError(err)
+			}
+			if c.options.Reconnect == nil || !c.reconnect(err) {
+				c.Close()
+				return
+			}
 			continue
 		}
+	}
+}
 
-		if messageType != websocket.TextMessage {
-			c.mtx.Unlock()
-			continue
+// Dispatch the STOMP frames contained in a SockJS frame
+//
+// Only errors that end the connection are returned, all others are reported
+// through the error channel.
+func (c *SockJSClient) handleFrame(data string) error {
+	messages, err := ParseSockJSMessage(data)
+	if err != nil {
+		var closeErr *SockJSCloseError
+		if errors.As(err, &closeErr) {
+			return err
 		}
 
-		// Parse message
-		msg, err := ParseSockJSMessage(string(data))
-		if err != nil {
-			c.errChan <- err
-			c.mtx.Unlock()
-			continue
-		}
+		c.emitError(err)
+		return nil
+	}
 
-		if msg != nil {
-			c.msgChan <- msg
+	for _, msg := range messages {
+		switch msg.Command {
+		case "MESSAGE":
+			c.emitMessage(msg)
+		case "RECEIPT":
+			c.handleReceipt(msg.Headers["receipt-id"])
+		case "ERROR":
+			// The server closes the connection after an ERROR frame
+			return newStompError(msg)
 		}
-		c.mtx.Unlock()
 	}
+
+	return nil
+}
+
+func (c *SockJSClient) handleReceipt(receiptID string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if receipt, ok := c.receipts[receiptID]; ok {
+		close(receipt)
+		delete(c.receipts, receiptID)
+	}
+}
+
+// Deliver a message to its subscription according to the overflow policy
+//
+// Messages that belong to no subscription, e.g. those still in flight after
+// an Unsubscribe, are dropped.
+func (c *SockJSClient) emitMessage(msg *SockJSMessage) {
+	sub := c.findSubscription(msg.Headers["subscription"])
+	if sub == nil {
+		log.Debugf("Dropping a message for unknown subscription %q to %s", msg.Headers["subscription"], msg.Headers["destination"])
+		return
+	}
+
+	delivered := deliver(c, sub.msgChan, msg, c.options.Overflow, sub.doneChan)
+	if !delivered && c.options.Overflow == OverflowReportError {
+		c.emitError(&OverflowError{Destination: msg.Headers["destination"]})
+	}
+}
+
+// Deliver an error, old errors are discarded if the consumer does not keep
+// up unless the overflow policy is to block
+func (c *SockJSClient) emitError(err error) {
+	policy := OverflowDropOldest
+	if c.options.Overflow == OverflowBlock {
+		policy = OverflowBlock
+	}
+
+	deliver(c, c.errChan, err, policy, nil)
 }
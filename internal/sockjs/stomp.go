@@ -0,0 +1,252 @@
+package sockjs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A STOMP 1.2 frame
+type Frame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+// An ERROR frame sent by the server
+type StompError struct {
+	Message string
+	Body    string
+}
+
+func (e *StompError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("STOMP error: %s", e.Message)
+	}
+
+	return fmt.Sprintf("STOMP error: %s: %s", e.Message, e.Body)
+}
+
+// Create a frame with the given command and headers
+func NewFrame(command string, headers map[string]string, body []byte) *Frame {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	return &Frame{
+		Command: command,
+		Headers: headers,
+		Body:    body,
+	}
+}
+
+// CONNECT and CONNECTED frames are exempt from header escaping
+func isEscapedCommand(command string) bool {
+	return command != "CONNECT" && command != "CONNECTED"
+}
+
+// Encode the frame in its wire format including the terminating NUL
+//
+// Headers are written in sorted order and a content-length header is added
+// for non-empty bodies.
+func (f *Frame) Encode() []byte {
+	var buf bytes.Buffer
+	escape := isEscapedCommand(f.Command)
+
+	buf.WriteString(f.Command)
+	buf.WriteByte('\n')
+
+	names := make([]string, 0, len(f.Headers))
+	for name := range f.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "content-length" {
+			continue
+		}
+
+		value := f.Headers[name]
+		if escape {
+			name = escapeHeader(name)
+			value = escapeHeader(value)
+		}
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	if len(f.Body) > 0 {
+		buf.WriteString("content-length:" + strconv.Itoa(len(f.Body)) + "\n")
+	}
+
+	buf.WriteByte('\n')
+	buf.Write(f.Body)
+	buf.WriteByte(0)
+
+	return buf.Bytes()
+}
+
+// Decode all frames contained in data
+//
+// Heartbeat EOLs between frames are skipped.
+func DecodeFrames(data []byte) ([]*Frame, error) {
+	frames := []*Frame{}
+
+	for {
+		data = skipEOLs(data)
+		if len(data) == 0 {
+			return frames, nil
+		}
+
+		frame, rest, err := decodeFrame(data)
+		if err != nil {
+			return nil, err
+		}
+
+		frames = append(frames, frame)
+		data = rest
+	}
+}
+
+// Decode a single frame and return the remaining data
+func decodeFrame(data []byte) (*Frame, []byte, error) {
+	// Command
+	command, data, ok := cutLine(data)
+	if !ok {
+		return nil, nil, fmt.Errorf("incomplete STOMP frame: missing command")
+	}
+	if command == "" {
+		return nil, nil, fmt.Errorf("invalid STOMP frame: empty command")
+	}
+	frame := NewFrame(command, nil, nil)
+	escape := isEscapedCommand(command)
+
+	// Headers
+	for {
+		var line string
+		line, data, ok = cutLine(data)
+		if !ok {
+			return nil, nil, fmt.Errorf("incomplete STOMP frame: unterminated headers")
+		}
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, nil, fmt.Errorf("invalid STOMP header %q", line)
+		}
+		if escape {
+			var err error
+			if name, err = unescapeHeader(name); err != nil {
+				return nil, nil, err
+			}
+			if value, err = unescapeHeader(value); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// Only the first occurrence of a repeated header is used
+		if _, exists := frame.Headers[name]; !exists {
+			frame.Headers[name] = value
+		}
+	}
+
+	// Body
+	if lengthHeader, ok := frame.Headers["content-length"]; ok {
+		length, err := strconv.Atoi(lengthHeader)
+		if err != nil || length < 0 {
+			return nil, nil, fmt.Errorf("invalid content-length %q", lengthHeader)
+		}
+		if len(data) < length+1 {
+			return nil, nil, fmt.Errorf("incomplete STOMP frame: body shorter than content-length")
+		}
+		if data[length] != 0 {
+			return nil, nil, fmt.Errorf("invalid STOMP frame: body not terminated by NUL")
+		}
+
+		frame.Body = data[:length]
+		return frame, data[length+1:], nil
+	}
+
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return nil, nil, fmt.Errorf("incomplete STOMP frame: body not terminated by NUL")
+	}
+
+	frame.Body = data[:end]
+	return frame, data[end+1:], nil
+}
+
+// Split off a line terminated by LF or CRLF
+func cutLine(data []byte) (string, []byte, bool) {
+	line, rest, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return "", nil, false
+	}
+
+	return string(bytes.TrimSuffix(line, []byte("\r"))), rest, true
+}
+
+func skipEOLs(data []byte) []byte {
+	for len(data) > 0 {
+		switch {
+		case data[0] == '\n':
+			data = data[1:]
+		case len(data) > 1 && data[0] == '\r' && data[1] == '\n':
+			data = data[2:]
+		default:
+			return data
+		}
+	}
+
+	return data
+}
+
+var headerEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\r", `\r`,
+	"\n", `\n`,
+	":", `\c`,
+)
+
+func escapeHeader(s string) string {
+	return headerEscaper.Replace(s)
+}
+
+func unescapeHeader(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("invalid STOMP header escape at end of %q", s)
+		}
+		switch s[i] {
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			return "", fmt.Errorf("invalid STOMP header escape \\%c", s[i])
+		}
+	}
+
+	return b.String(), nil
+}
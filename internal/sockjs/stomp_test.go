@@ -0,0 +1,253 @@
+package sockjs
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaderEscapingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		encoded string
+	}{
+		{"colon", "a:b", `a\cb`},
+		{"newline", "a\nb", `a\nb`},
+		{"carriage return", "a\rb", `a\rb`},
+		{"backslash", `a\b`, `a\\b`},
+		{"all", "\\:\r\n", `\\\c\r\n`},
+		{"plain", "plain", "plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := NewFrame("SEND", map[string]string{"x-value": tt.value}, nil)
+			encoded := frame.Encode()
+
+			want := "SEND\nx-value:" + tt.encoded + "\n\n\x00"
+			if string(encoded) != want {
+				t.Fatalf("Encode() = %q, want %q", encoded, want)
+			}
+
+			frames, err := DecodeFrames(encoded)
+			if err != nil {
+				t.Fatalf("DecodeFrames() error = %v", err)
+			}
+			if len(frames) != 1 || frames[0].Headers["x-value"] != tt.value {
+				t.Fatalf("DecodeFrames() = %+v, want header %q", frames, tt.value)
+			}
+		})
+	}
+}
+
+func TestConnectFramesAreNotEscaped(t *testing.T) {
+	frame := NewFrame("CONNECT", map[string]string{"host": "a:b"}, nil)
+
+	if got, want := string(frame.Encode()), "CONNECT\nhost:a:b\n\n\x00"; got != want {
+		t.Fatalf("Encode() = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []*Frame
+		wantErr string
+	}{
+		{
+			name: "content-length body with NUL bytes",
+			data: "MESSAGE\ncontent-length:5\nsubscription:0\n\na\x00b\x00c\x00",
+			want: []*Frame{{
+				Command: "MESSAGE",
+				Headers: map[string]string{"content-length": "5", "subscription": "0"},
+				Body:    []byte("a\x00b\x00c"),
+			}},
+		},
+		{
+			name: "multiple frames and heartbeats",
+			data: "\nMESSAGE\nsubscription:0\n\n{}\x00\r\n\nRECEIPT\nreceipt-id:1\n\n\x00\n",
+			want: []*Frame{
+				{Command: "MESSAGE", Headers: map[string]string{"subscription": "0"}, Body: []byte("{}")},
+				{Command: "RECEIPT", Headers: map[string]string{"receipt-id": "1"}, Body: []byte{}},
+			},
+		},
+		{
+			name: "error frame",
+			data: "ERROR\nmessage:access denied\n\nnot allowed\x00",
+			want: []*Frame{{
+				Command: "ERROR",
+				Headers: map[string]string{"message": "access denied"},
+				Body:    []byte("not allowed"),
+			}},
+		},
+		{
+			name: "repeated header keeps the first value",
+			data: "MESSAGE\nfoo:1\nfoo:2\n\n\x00",
+			want: []*Frame{{Command: "MESSAGE", Headers: map[string]string{"foo": "1"}, Body: []byte{}}},
+		},
+		{
+			name: "only heartbeats",
+			data: "\n\r\n\n",
+			want: []*Frame{},
+		},
+		{
+			name:    "body shorter than content-length",
+			data:    "MESSAGE\ncontent-length:10\n\nshort\x00",
+			wantErr: "body shorter than content-length",
+		},
+		{
+			name:    "content-length body without NUL",
+			data:    "MESSAGE\ncontent-length:2\n\nabc\x00",
+			wantErr: "body not terminated by NUL",
+		},
+		{
+			name:    "missing NUL",
+			data:    "MESSAGE\n\nbody",
+			wantErr: "body not terminated by NUL",
+		},
+		{
+			name:    "unterminated headers",
+			data:    "MESSAGE\nfoo:bar",
+			wantErr: "unterminated headers",
+		},
+		{
+			name:    "invalid escape",
+			data:    "MESSAGE\nfoo:a\\tb\n\n\x00",
+			wantErr: "invalid STOMP header escape",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := DecodeFrames([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DecodeFrames() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeFrames() error = %v", err)
+			}
+			if !reflect.DeepEqual(frames, tt.want) {
+				t.Fatalf("DecodeFrames() = %+v, want %+v", frames, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeAddsContentLength(t *testing.T) {
+	body := []byte("a\x00b")
+	frame := NewFrame("SEND", map[string]string{"destination": "/topic", "content-length": "99"}, body)
+
+	encoded := frame.Encode()
+	if want := "SEND\ndestination:/topic\ncontent-length:3\n\na\x00b\x00"; string(encoded) != want {
+		t.Fatalf("Encode() = %q, want %q", encoded, want)
+	}
+
+	frames, err := DecodeFrames(encoded)
+	if err != nil {
+		t.Fatalf("DecodeFrames() error = %v", err)
+	}
+	if len(frames) != 1 || !bytes.Equal(frames[0].Body, body) {
+		t.Fatalf("DecodeFrames() = %+v, want body %q", frames, body)
+	}
+}
+
+func TestParseSockJSMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		commands []string
+		closeErr *SockJSCloseError
+		wantErr  bool
+	}{
+		{name: "open", data: "o", commands: []string{}},
+		{name: "heartbeat", data: "h", commands: []string{}},
+		{
+			name:     "several frames in one envelope",
+			data:     `a["MESSAGE\nsubscription:0\n\n{\"a\":1}\u0000\nMESSAGE\nsubscription:1\n\n{}\u0000","\n","RECEIPT\nreceipt-id:7\n\n\u0000"]`,
+			commands: []string{"MESSAGE", "MESSAGE", "RECEIPT"},
+		},
+		{
+			name:     "single message",
+			data:     `m"ERROR\nmessage:bad\n\n\u0000"`,
+			commands: []string{"ERROR"},
+		},
+		{
+			name:     "close",
+			data:     `c[3000,"Go away!"]`,
+			closeErr: &SockJSCloseError{Code: 3000, Reason: "Go away!"},
+		},
+		{name: "malformed close", data: `c[3000]`, wantErr: true},
+		{name: "malformed array", data: `a[`, wantErr: true},
+		{name: "unknown type", data: `x`, wantErr: true},
+		{name: "empty", data: ``, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := ParseSockJSMessage(tt.data)
+			if tt.closeErr != nil {
+				var closeErr *SockJSCloseError
+				if !errors.As(err, &closeErr) || *closeErr != *tt.closeErr {
+					t.Fatalf("ParseSockJSMessage() error = %v, want %v", err, tt.closeErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseSockJSMessage() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSockJSMessage() error = %v", err)
+			}
+
+			commands := []string{}
+			for _, msg := range messages {
+				commands = append(commands, msg.Command)
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Fatalf("ParseSockJSMessage() commands = %v, want %v", commands, tt.commands)
+			}
+		})
+	}
+}
+
+func TestParseSockJSMessageBody(t *testing.T) {
+	messages, err := ParseSockJSMessage(`a["MESSAGE\nsubscription:0\n\n{\"score\":100}\u0000ERROR\nmessage:oops\n\nplain\u0000"]`)
+	if err != nil {
+		t.Fatalf("ParseSockJSMessage() error = %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("ParseSockJSMessage() returned %d messages, want 2", len(messages))
+	}
+
+	if messages[0].Body == nil || (*messages[0].Body)["score"] != float64(100) {
+		t.Errorf("JSON body = %v, want score 100", messages[0].Body)
+	}
+	if messages[1].Body != nil || string(messages[1].RawBody) != "plain" {
+		t.Errorf("plain body = %v %q, want only the raw body", messages[1].Body, messages[1].RawBody)
+	}
+
+	stompErr := newStompError(messages[1])
+	if want := "STOMP error: oops: plain"; stompErr.Error() != want {
+		t.Errorf("StompError = %q, want %q", stompErr.Error(), want)
+	}
+}
+
+func TestEncodeSockJSFrame(t *testing.T) {
+	encoded, err := EncodeSockJSFrame("SEND\n\n\x00")
+	if err != nil {
+		t.Fatalf("EncodeSockJSFrame() error = %v", err)
+	}
+	if want := `["SEND\n\n\u0000"]`; encoded != want {
+		t.Fatalf("EncodeSockJSFrame() = %s, want %s", encoded, want)
+	}
+}
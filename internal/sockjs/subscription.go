@@ -0,0 +1,57 @@
+package sockjs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A subscription to a single destination
+//
+// Messages from the server are only delivered through subscriptions, those
+// belonging to none are dropped.
+type Subscription struct {
+	ID          string
+	Destination string
+
+	client   *SockJSClient
+	msgChan  chan *SockJSMessage
+	doneChan chan struct{}
+}
+
+// Returns a channel that receives the messages sent to this subscription.
+//
+// The channel is buffered and subject to the client's overflow policy.
+func (s *Subscription) Messages() <-chan *SockJSMessage {
+	return s.msgChan
+}
+
+// Returns a channel that is closed once the subscription ended, either by
+// Unsubscribe or by closing the client.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.doneChan
+}
+
+// Stop receiving messages for this subscription
+func (s *Subscription) Unsubscribe() error {
+	if !s.client.removeSubscription(s) {
+		return nil
+	}
+
+	return s.client.SendFrame(NewFrame("UNSUBSCRIBE", map[string]string{
+		"id": s.ID,
+	}, nil))
+}
+
+// Decode the JSON body of a message into a value of type T
+func Decode[T any](msg *SockJSMessage) (T, error) {
+	var value T
+	if len(msg.RawBody) == 0 {
+		return value, fmt.Errorf("message to %s has no body", msg.Headers["destination"])
+	}
+
+	if err := json.Unmarshal(msg.RawBody, &value); err != nil {
+		return value, fmt.Errorf("failed to decode message to %s: %w", msg.Headers["destination"], err)
+	}
+
+	return value, nil
+}
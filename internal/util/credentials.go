@@ -2,8 +2,12 @@ package util
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
+	"runtime"
 	"strings"
 	"syscall"
 
@@ -29,3 +33,92 @@ func GetCredentialsInteractive() (string, string, error) {
 	password := string(passwordBytes)
 	return strings.TrimSpace(username), strings.TrimSpace(password), nil
 }
+
+// Read a password from the first line of stdin
+func ReadPasswordStdin() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("could not read the password from stdin: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Run a shell command and use the first line of its stdout as the password
+//
+// Stderr and stdin are passed through so that the command can prompt, e.g.
+// for the passphrase of a password manager.
+func RunPasswordCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	password, _, _ := strings.Cut(stdout.String(), "\n")
+	password = strings.TrimSuffix(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("password command printed no password")
+	}
+
+	return password, nil
+}
+
+// Ask for a line of input on the terminal
+func PromptLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// Ask for a secret on the terminal without echoing it
+func PromptSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	secret, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+// Ask for a secret on the controlling terminal, printing the prompt to stderr
+//
+// This works while stdin and stdout are pipes, e.g. those of git's credential
+// helper protocol.
+func PromptSecretTerminal(prompt string) (string, error) {
+	path := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		path = "CONIN$"
+	}
+
+	tty, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask on: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
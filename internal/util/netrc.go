@@ -0,0 +1,119 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+type NetrcEntry struct {
+	Login    string
+	Password string
+}
+
+// The path of the netrc file, honouring $NETRC
+func NetrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// Look up the entry for host in the netrc file at path
+//
+// Falls back to the default entry. Returns nil if neither exists or the file
+// does not exist.
+func LookupNetrc(path, host string) (*NetrcEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var match, fallback, current *NetrcEntry
+	inMacro := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Macro definitions run until the next empty line
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "#") {
+				break
+			}
+
+			value := func() (string, error) {
+				i++
+				if i == len(fields) {
+					return "", fmt.Errorf("invalid netrc file: missing value for %q", fields[i-1])
+				}
+				return fields[i], nil
+			}
+
+			switch fields[i] {
+			case "machine":
+				name, err := value()
+				if err != nil {
+					return nil, err
+				}
+				current = &NetrcEntry{}
+				if match == nil && name == host {
+					match = current
+				}
+			case "default":
+				current = &NetrcEntry{}
+				if fallback == nil {
+					fallback = current
+				}
+			case "login", "password", "account":
+				val, err := value()
+				if err != nil {
+					return nil, err
+				}
+				if current == nil {
+					continue
+				}
+				switch fields[i-1] {
+				case "login":
+					current.Login = val
+				case "password":
+					current.Password = val
+				}
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if match != nil {
+		return match, nil
+	}
+	return fallback, nil
+}
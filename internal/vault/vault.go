@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/coronon/artemisbot/internal/util"
+)
+
+// Name of the vault file inside the working directory
+const Filename = "credentials.vault"
+
+const (
+	formatVersion = 1
+	kdfArgon2id   = "argon2id"
+	saltSize      = 16
+
+	// Argon2id parameters as recommended by RFC 9106 for memory-constrained
+	// environments
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+
+	// Upper bounds for the parameters read from the file, so a corrupted
+	// vault cannot make the key derivation hang or exhaust memory
+	maxArgonTime   = 16
+	maxArgonMemory = 1024 * 1024
+)
+
+// Authenticated together with the ciphertext to bind it to this format
+var additionalData = []byte("artemisbot-vault-v1")
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted vault")
+
+// Credentials stored for one Artemis host
+type Entry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// An Artemis JWT for instances without password login
+	Token string `json:"token,omitempty"`
+	// A VCS access token used for git instead of the password
+	VCSToken string `json:"vcsToken,omitempty"`
+}
+
+// On-disk format of the vault
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Time       uint32 `json:"time"`
+	Memory     uint32 `json:"memory"`
+	Threads    uint8  `json:"threads"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// An encrypted store of credentials per Artemis host
+//
+// The entries are encrypted with XChaCha20-Poly1305 using a key derived from
+// a passphrase with Argon2id. The whole vault is decrypted on Open and
+// re-encrypted with a fresh salt and nonce on every Save.
+type Vault struct {
+	path       string
+	passphrase []byte
+	entries    map[string]Entry
+}
+
+// The path of the vault inside workdir
+func Path(workdir string) string {
+	return filepath.Join(workdir, Filename)
+}
+
+// Check whether a vault was created in workdir
+func Exists(workdir string) bool {
+	_, err := os.Stat(Path(workdir))
+	return err == nil
+}
+
+// Reject key derivation parameters argon2 cannot or should not handle
+func (f *file) checkKDF() error {
+	switch {
+	case len(f.Salt) != saltSize:
+		return fmt.Errorf("invalid vault: the salt must be %d bytes", saltSize)
+	case f.Time < 1 || f.Time > maxArgonTime:
+		return fmt.Errorf("invalid vault: time must be between 1 and %d", maxArgonTime)
+	case f.Memory < 8*uint32(f.Threads) || f.Memory > maxArgonMemory:
+		return fmt.Errorf("invalid vault: memory must be between 8 KiB per thread and %d KiB", maxArgonMemory)
+	case f.Threads < 1:
+		return fmt.Errorf("invalid vault: threads must be at least 1")
+	}
+
+	return nil
+}
+
+// Open and decrypt the vault in workdir
+//
+// An empty vault is returned if none exists yet, it is only written on Save.
+func Open(workdir string, passphrase []byte) (*Vault, error) {
+	v := &Vault{
+		path:       Path(workdir),
+		passphrase: passphrase,
+		entries:    map[string]Entry{},
+	}
+
+	data, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the vault: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("could not parse the vault: %w", err)
+	}
+	if f.Version != formatVersion || f.KDF != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported vault format %d (%s)", f.Version, f.KDF)
+	}
+
+	if err := f.checkKDF(); err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(passphrase, f.Salt, f.Time, f.Memory, f.Threads, chacha20poly1305.KeySize))
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	if err := json.Unmarshal(plaintext, &v.entries); err != nil {
+		return nil, fmt.Errorf("could not parse the vault: %w", err)
+	}
+
+	return v, nil
+}
+
+// Get the credentials stored for host
+func (v *Vault) Get(host string) (Entry, bool) {
+	entry, ok := v.entries[host]
+	return entry, ok
+}
+
+// Store the credentials for host, replacing previous ones
+func (v *Vault) Set(host string, entry Entry) {
+	v.entries[host] = entry
+}
+
+// Remove the credentials stored for host
+//
+// Returns false if there were none.
+func (v *Vault) Delete(host string) bool {
+	if _, ok := v.entries[host]; !ok {
+		return false
+	}
+
+	delete(v.entries, host)
+	return true
+}
+
+// All hosts with stored credentials in sorted order
+func (v *Vault) Hosts() []string {
+	hosts := make([]string, 0, len(v.entries))
+	for host := range v.entries {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// Encrypt the vault and write it to disk
+//
+// The file is only readable by the current user and replaced atomically.
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(v.entries)
+	if err != nil {
+		return err
+	}
+
+	f := file{
+		Version: formatVersion,
+		KDF:     kdfArgon2id,
+		Salt:    make([]byte, saltSize),
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+		Nonce:   make([]byte, chacha20poly1305.NonceSizeX),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(v.passphrase, f.Salt, f.Time, f.Memory, f.Threads, chacha20poly1305.KeySize))
+	if err != nil {
+		return err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, additionalData)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(v.path, data, 0600); err != nil {
+		return fmt.Errorf("could not write the vault: %w", err)
+	}
+
+	return nil
+}